@@ -0,0 +1,273 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/strowk/foxy-contexts/pkg/fxctx"
+	"github.com/strowk/foxy-contexts/pkg/mcp"
+)
+
+// ThoughtRef identifies a recorded thought by its number and branch.
+type ThoughtRef struct {
+	ThoughtNumber int    `json:"thoughtNumber"`
+	BranchID      string `json:"branchId,omitempty"`
+}
+
+// Compaction is the "current best" chain of a session: the line of thought
+// that leads to its conclusion, with its revisions applied in place and
+// without the branches it does not follow. The history it was
+// compacted from is left untouched as the audit log.
+type Compaction struct {
+	// Thoughts is the chain, revised thoughts carrying the text of their
+	// latest revision. It is left out of JSON, where the document the
+	// compaction describes carries it.
+	Thoughts []ThoughtData `json:"-"`
+	// Chain is the same chain with the revisions applied to each step.
+	Chain []ResolvedThought `json:"-"`
+	// Lineage holds the positions in the history of the thoughts the chain
+	// was compacted from, revisions included.
+	Lineage []int `json:"-"`
+	// HistoryLength is the number of thoughts in the audit log.
+	HistoryLength int `json:"historyLength"`
+	// Concluded reports whether the chain ends at a thought that needed no
+	// further thinking.
+	Concluded bool `json:"concluded"`
+	// Superseded lists the thoughts of the chain that later thoughts of
+	// the chain revised.
+	Superseded []ThoughtRef `json:"superseded"`
+	// MergedBranches lists the branches merged into the chain, directly or
+	// through other merged branches, in creation order.
+	MergedBranches []string `json:"mergedBranches"`
+	// AbandonedBranches lists the branches left in the abandoned state, in
+	// creation order.
+	AbandonedBranches []string `json:"abandonedBranches"`
+	// OpenBranches lists the other branches the chain neither follows nor
+	// merges, in creation order.
+	OpenBranches []string `json:"openBranches"`
+	// Issues lists the revisions of the chain that could not be applied
+	// cleanly.
+	Issues []RevisionIssue `json:"issues"`
+}
+
+// CompactHistory compacts a session history. The chain ends at the latest
+// thought that needed no further thinking or, if thinking never concluded,
+// at the latest thought, and follows its lineage back through the branches
+// it came from. Thoughts on abandoned branches never end the chain, and once
+// a branch is chosen the chain ends at a thought that follows or merges it.
+func CompactHistory(history []ThoughtData) *Compaction {
+	c := &Compaction{
+		HistoryLength:     len(history),
+		Superseded:        []ThoughtRef{},
+		MergedBranches:    []string{},
+		AbandonedBranches: []string{},
+		OpenBranches:      []string{},
+		Chain:             []ResolvedThought{},
+		Issues:            []RevisionIssue{},
+	}
+	if len(history) == 0 {
+		return c
+	}
+
+	g := NewThoughtGraph(history)
+	states := finalBranchStates(history)
+	chosen := ""
+	for id, state := range states {
+		if state == BranchChosen {
+			chosen = id
+		}
+	}
+
+	end := -1
+	var lineage []int
+	var followed, merged map[string]bool
+	pick := func(concluded bool) {
+		for i := len(history) - 1; i >= 0 && end < 0; i-- {
+			t := history[i]
+			if states[t.BranchID] == BranchAbandoned || concluded && !isFinal(&t) {
+				continue
+			}
+			lineage = g.Lineage(i)
+			followed, merged = followedBranches(history, lineage)
+			if chosen == "" || followed[chosen] || merged[chosen] {
+				end = i
+			}
+		}
+	}
+	pick(true)
+	pick(false)
+	if end < 0 {
+		end = len(history) - 1
+		lineage = g.Lineage(end)
+		followed, merged = followedBranches(history, lineage)
+	}
+
+	// Revisions made on abandoned branches are not on the lineage, so they
+	// do not count.
+	chain, issues := resolveLine(history, lineage)
+	for _, step := range chain.Thoughts {
+		if len(step.RevisedBy) > 0 {
+			c.Superseded = append(c.Superseded, refOf(&step.ThoughtData))
+		}
+		c.Thoughts = append(c.Thoughts, step.ThoughtData)
+	}
+	c.Chain = chain.Thoughts
+	c.Lineage = lineage
+	c.Issues = append(c.Issues, issues...)
+	c.Concluded = isFinal(&history[end])
+
+	for _, t := range history {
+		switch {
+		case followed[t.BranchID]:
+		case merged[t.BranchID]:
+			c.MergedBranches = append(c.MergedBranches, t.BranchID)
+		case states[t.BranchID] == BranchAbandoned:
+			c.AbandonedBranches = append(c.AbandonedBranches, t.BranchID)
+		default:
+			c.OpenBranches = append(c.OpenBranches, t.BranchID)
+		}
+		followed[t.BranchID] = true
+	}
+
+	return c
+}
+
+// LeftOut reports whether the chain leaves the branch out.
+func (c *Compaction) LeftOut(branchID string) bool {
+	return slices.Contains(c.AbandonedBranches, branchID) || slices.Contains(c.OpenBranches, branchID)
+}
+
+// followedBranches returns the branches a lineage goes through and the
+// branches merged into it, directly or through other merged branches.
+func followedBranches(history []ThoughtData, lineage []int) (followed, merged map[string]bool) {
+	followed = map[string]bool{}
+	var merges []string
+	for _, node := range lineage {
+		followed[history[node].BranchID] = true
+		if b := history[node].MergeBranch; b != "" {
+			merges = append(merges, b)
+		}
+	}
+
+	// A merged branch brings along the branches merged into it.
+	merged = map[string]bool{}
+	for len(merges) > 0 {
+		b := merges[0]
+		merges = merges[1:]
+		if merged[b] || followed[b] {
+			continue
+		}
+		merged[b] = true
+		for _, t := range history {
+			if t.BranchID == b && t.MergeBranch != "" {
+				merges = append(merges, t.MergeBranch)
+			}
+		}
+	}
+
+	return followed, merged
+}
+
+func isFinal(t *ThoughtData) bool {
+	return t.NextThoughtNeeded != nil && !*t.NextThoughtNeeded
+}
+
+// Summary describes in a sentence what the compaction collapsed.
+func (c *Compaction) Summary() string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "%d of %d thoughts in the current best chain", len(c.Thoughts), c.HistoryLength)
+	if n := len(c.Superseded); n > 0 {
+		fmt.Fprintf(&b, ", %d superseded by revisions", n)
+	}
+	if len(c.MergedBranches) > 0 {
+		fmt.Fprintf(&b, ", merged branches: %s", strings.Join(c.MergedBranches, ", "))
+	}
+	if len(c.AbandonedBranches) > 0 {
+		fmt.Fprintf(&b, ", abandoned branches: %s", strings.Join(c.AbandonedBranches, ", "))
+	}
+	if len(c.OpenBranches) > 0 {
+		fmt.Fprintf(&b, ", open branches left out: %s", strings.Join(c.OpenBranches, ", "))
+	}
+	if n := len(c.Issues); n > 0 {
+		fmt.Fprintf(&b, ", %d revision issues", n)
+	}
+
+	return b.String()
+}
+
+// NewCompactSessionTool creates the tool that collapses a session into its
+// current best chain. It only reads the session: nothing is discarded, so the
+// history keeps growing towards the history limit.
+func NewCompactSessionTool(store *ThoughtStore, opts Options) fxctx.Tool {
+	return fxctx.NewTool(
+		&mcp.Tool{
+			Name:        "compact_session",
+			Description: ptr("Collapse a session into its current best chain of thoughts: the line that leads to the conclusion, without the thoughts its revisions superseded and without the branches it does not follow. Abandoned branches never end the chain, and a chosen branch is always part of it. This is a view: the session keeps every recorded thought, in memory, in storage and against the maxHistory limit, and end_session is the only way to discard them."),
+			InputSchema: mcp.ToolInputSchema{
+				Type: "object",
+				Properties: map[string]map[string]any{
+					"sessionId": {
+						"type":        "string",
+						"description": "Session to compact; defaults to the session that most recently recorded a thought, and is required on servers shared over http or sse",
+					},
+					"format": {
+						"type":        "string",
+						"enum":        renderFormats,
+						"description": "How to render the chain, defaulting to the format of sequential_thinking responses",
+					},
+				},
+			},
+		},
+		func(args map[string]any) *mcp.CallToolResult {
+			sessionID, err := stringArg(args, "sessionId")
+			if err != nil {
+				return toolErrorResult(err)
+			}
+			sessionID, err = store.SessionOrCurrent(sessionID)
+			if err != nil {
+				return toolErrorResult(err)
+			}
+
+			format, err := stringArg(args, "format")
+			if err != nil {
+				return toolErrorResult(err)
+			}
+			if format == "" {
+				format = opts.Format
+			}
+			renderer, err := rendererFor(format)
+			if err != nil {
+				return toolErrorResult(err)
+			}
+
+			history := store.History(sessionID)
+			if len(history) == 0 {
+				return toolErrorResult(fmt.Errorf("session %q has no recorded thoughts", sessionID))
+			}
+			c := CompactHistory(history)
+
+			var b strings.Builder
+			fmt.Fprintf(&b, "Session %s: %s.\n", sessionID, c.Summary())
+			for i := range c.Thoughts {
+				b.WriteString("\n")
+				b.WriteString(renderer.Render(&c.Thoughts[i]))
+			}
+			for _, issue := range c.Issues {
+				fmt.Fprintf(&b, "\nWarning: %s.\n", issue.Message)
+			}
+
+			return textResult(b.String(), map[string]any{
+				"sessionId":            sessionID,
+				"thoughts":             len(c.Thoughts),
+				"thoughtHistoryLength": c.HistoryLength,
+				"superseded":           c.Superseded,
+				"mergedBranches":       c.MergedBranches,
+				"abandonedBranches":    c.AbandonedBranches,
+				"openBranches":         c.OpenBranches,
+				"issues":               c.Issues,
+			})
+		},
+	)
+}
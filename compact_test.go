@@ -0,0 +1,184 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/strowk/foxy-contexts/pkg/mcp"
+)
+
+// newCompactStore records a session whose main line revises thought 2 and
+// concludes without following branch alt, which revises thought 1:
+// 1 -> 2 -> 3 (revises 2) -> 4 (final), and alt from 1 with 2 (revises 1).
+func newCompactStore(t *testing.T) *ThoughtStore {
+	t.Helper()
+
+	return recordSession(t, Options{}, "s",
+		map[string]any{"thought": "Frame the problem", "thoughtNumber": 1, "totalThoughts": 4},
+		map[string]any{"thought": "First attempt", "thoughtNumber": 2, "totalThoughts": 4},
+		map[string]any{"thought": "Reframe", "thoughtNumber": 2, "totalThoughts": 4, "branchFromThought": 1, "branchId": "alt", "isRevision": true, "revisesThought": 1},
+		map[string]any{"thought": "Second attempt", "thoughtNumber": 3, "totalThoughts": 4, "isRevision": true, "revisesThought": 2},
+		map[string]any{"thought": "Conclusion", "thoughtNumber": 4, "totalThoughts": 4, "nextThoughtNeeded": false},
+	)
+}
+
+func thoughtTexts(thoughts []ThoughtData) []string {
+	texts := make([]string, len(thoughts))
+	for i, t := range thoughts {
+		texts[i] = t.Thought
+	}
+	return texts
+}
+
+func TestCompactHistory(t *testing.T) {
+	history := newCompactStore(t).History("s")
+
+	c := CompactHistory(history)
+	if got, want := thoughtTexts(c.Thoughts), []string{"Frame the problem", "Second attempt", "Conclusion"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Chain = %q, want %q", got, want)
+	}
+	if want := []ThoughtRef{{ThoughtNumber: 2}}; !reflect.DeepEqual(c.Superseded, want) {
+		t.Errorf("Superseded = %v, want %v", c.Superseded, want)
+	}
+	if want := []string{"alt"}; !reflect.DeepEqual(c.OpenBranches, want) || len(c.AbandonedBranches) != 0 {
+		t.Errorf("Expected alt left out but open, got open %v, abandoned %v", c.OpenBranches, c.AbandonedBranches)
+	}
+	if c.HistoryLength != 5 {
+		t.Errorf("HistoryLength = %d, want 5", c.HistoryLength)
+	}
+	if want := "3 of 5 thoughts in the current best chain, 1 superseded by revisions, open branches left out: alt"; c.Summary() != want {
+		t.Errorf("Summary() = %q, want %q", c.Summary(), want)
+	}
+
+	t.Run("unfinished thinking ends at the latest thought", func(t *testing.T) {
+		// Without the conclusion, the chain follows the latest thought, on
+		// a branch whose revision now supersedes thought 1.
+		c := CompactHistory(history[:3])
+		if got, want := thoughtTexts(c.Thoughts), []string{"Reframe"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("Chain = %q, want %q", got, want)
+		}
+		if want := []ThoughtRef{{ThoughtNumber: 1}}; !reflect.DeepEqual(c.Superseded, want) {
+			t.Errorf("Superseded = %v, want %v", c.Superseded, want)
+		}
+	})
+
+	t.Run("merged branches are not abandoned", func(t *testing.T) {
+		merged := append(history[:4:4], ThoughtData{Thought: "Fold in the reframing", ThoughtNumber: 4, TotalThoughts: 4, MergeBranch: "alt", NextThoughtNeeded: ptr(false)})
+		c := CompactHistory(merged)
+		if want := []string{"alt"}; !reflect.DeepEqual(c.MergedBranches, want) || len(c.OpenBranches) != 0 {
+			t.Errorf("Expected alt merged, got merged %v, open %v", c.MergedBranches, c.OpenBranches)
+		}
+		if want := "merged branches: alt"; !strings.HasSuffix(c.Summary(), want) {
+			t.Errorf("Summary() = %q, want suffix %q", c.Summary(), want)
+		}
+	})
+
+	t.Run("empty history", func(t *testing.T) {
+		c := CompactHistory(nil)
+		if c.OpenBranches == nil {
+			t.Errorf("Expected an empty list of open branches, got %+v", c)
+		}
+		if len(c.Thoughts) != 0 || c.Superseded == nil || c.AbandonedBranches == nil {
+			t.Errorf("Expected an empty compaction with empty lists, got %+v", c)
+		}
+	})
+}
+
+func TestCompactHistoryBranchStates(t *testing.T) {
+	// 1 -> 2 on the main line, branch b from 2 is chosen and branch c from
+	// 2 concludes but is abandoned at once.
+	history := []ThoughtData{
+		{Thought: "Frame", ThoughtNumber: 1, TotalThoughts: 3},
+		{Thought: "Options", ThoughtNumber: 2, TotalThoughts: 3},
+		{Thought: "Option B", ThoughtNumber: 3, TotalThoughts: 3, BranchFromThought: ptr(2), BranchID: "b", BranchState: BranchChosen},
+		{Thought: "Option C", ThoughtNumber: 3, TotalThoughts: 3, BranchFromThought: ptr(2), BranchID: "c", BranchState: BranchAbandoned, BranchReason: "dead end", NextThoughtNeeded: ptr(false)},
+	}
+
+	c := CompactHistory(history)
+	if got, want := thoughtTexts(c.Thoughts), []string{"Frame", "Options", "Option B"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Chain = %q, want %q", got, want)
+	}
+	if c.Concluded {
+		t.Error("Expected the chosen branch to be unconcluded")
+	}
+	if want := []string{"c"}; !reflect.DeepEqual(c.AbandonedBranches, want) || len(c.OpenBranches) != 0 {
+		t.Errorf("Expected c abandoned, got abandoned %v, open %v", c.AbandonedBranches, c.OpenBranches)
+	}
+
+	t.Run("abandoned branches never end the chain", func(t *testing.T) {
+		history := append(history[:2:2], history[3])
+		c := CompactHistory(history)
+		if got, want := thoughtTexts(c.Thoughts), []string{"Frame", "Options"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("Chain = %q, want %q", got, want)
+		}
+		if want := []string{"c"}; !reflect.DeepEqual(c.AbandonedBranches, want) {
+			t.Errorf("AbandonedBranches = %v, want %v", c.AbandonedBranches, want)
+		}
+	})
+
+	t.Run("a conclusion merging the chosen branch ends the chain", func(t *testing.T) {
+		history := append(history[:4:4], ThoughtData{Thought: "Go with B", ThoughtNumber: 3, TotalThoughts: 3, MergeBranch: "b", NextThoughtNeeded: ptr(false)})
+		c := CompactHistory(history)
+		if got, want := thoughtTexts(c.Thoughts), []string{"Frame", "Options", "Go with B"}; !reflect.DeepEqual(got, want) || !c.Concluded {
+			t.Errorf("Chain = %q (concluded %v), want %q concluded", got, c.Concluded, want)
+		}
+		if want := []string{"b"}; !reflect.DeepEqual(c.MergedBranches, want) {
+			t.Errorf("MergedBranches = %v, want %v", c.MergedBranches, want)
+		}
+	})
+}
+
+func TestCompactSessionTool(t *testing.T) {
+	store := newCompactStore(t)
+	handler := NewCompactSessionTool(store, Options{Format: "compact"}).Callback
+
+	result := handler(map[string]any{})
+	if result.IsError != nil && *result.IsError {
+		t.Fatalf("Expected no error, got %s", resultText(result))
+	}
+	text := resultText(result)
+	if !strings.HasPrefix(text, "Session s: 3 of 5 thoughts in the current best chain") || strings.Contains(text, "First attempt") {
+		t.Errorf("Unexpected compaction:\n%s", text)
+	}
+	if result.Meta["thoughts"] != 3 || result.Meta["thoughtHistoryLength"] != 5 {
+		t.Errorf("Unexpected meta %v", result.Meta)
+	}
+
+	// Compacting leaves the audit log alone.
+	if n := len(store.History("s")); n != 5 {
+		t.Errorf("Expected 5 thoughts in the history, got %d", n)
+	}
+
+	if result := handler(map[string]any{"sessionId": "nope"}); result.IsError == nil || !*result.IsError {
+		t.Error("Expected an error for an unknown session")
+	}
+}
+
+func TestCompactedResources(t *testing.T) {
+	store := newCompactStore(t)
+
+	read := func(uri string) sessionResource {
+		t.Helper()
+		result, err := readThoughtResource(store, uri)
+		if err != nil {
+			t.Fatalf("Failed to read %s: %v", uri, err)
+		}
+		var doc sessionResource
+		if err := json.Unmarshal([]byte(result.Contents[0].(mcp.TextResourceContents).Text), &doc); err != nil {
+			t.Fatalf("Failed to decode %s: %v", uri, err)
+		}
+		return doc
+	}
+
+	doc := read("thoughts://session/s")
+	if len(doc.Thoughts) != 3 || doc.Compaction == nil || len(doc.Branches) != 0 {
+		t.Errorf("Expected the compacted chain without the abandoned branch, got %+v", doc)
+	}
+
+	doc = read("thoughts://session/s/log")
+	if len(doc.Thoughts) != 5 || doc.Compaction != nil || len(doc.Branches) != 1 {
+		t.Errorf("Expected the full log, got %+v", doc)
+	}
+}
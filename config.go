@@ -0,0 +1,324 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// envPrefix prefixes the environment variables that configure the server.
+const envPrefix = "SEQUENTIAL_THINKING_"
+
+// version is the server version reported to clients, set at build time
+// with -ldflags "-X main.version=...".
+var version = "1.0.0"
+
+// Config holds the server settings. They are resolved once at startup from,
+// in increasing order of precedence, the defaults, an optional YAML file,
+// environment variables and command-line flags.
+type Config struct {
+	// Name is the server name reported to clients.
+	Name string `yaml:"name"`
+
+	// Transport is the transport to serve MCP over: stdio, sse or http.
+	Transport string `yaml:"transport"`
+	// Listen is the address the sse and http transports listen on.
+	Listen string `yaml:"listen"`
+	// AllowedOrigins lists the browser origins, besides loopback ones, the
+	// sse and http transports accept requests from. "*" accepts any origin.
+	AllowedOrigins []string `yaml:"allowedOrigins"`
+
+	// DisableThoughtLogging replaces the formatted thought in tool
+	// responses with a short notice.
+	DisableThoughtLogging bool `yaml:"disableThoughtLogging"`
+	// ExtendTotal raises totalThoughts instead of rejecting thoughts
+	// beyond the current estimate.
+	ExtendTotal bool `yaml:"extendTotal"`
+	// Strict rejects unknown tool arguments and values of the wrong type.
+	// Otherwise unknown arguments are ignored and numbers and booleans sent
+	// as strings are parsed.
+	Strict bool `yaml:"strict"`
+	// OutputFormat names the renderer of tool responses: emoji, plain,
+	// compact, markdown or json.
+	OutputFormat string `yaml:"outputFormat"`
+	// MaxHistory limits the number of thoughts a session can record,
+	// zero means no limit.
+	MaxHistory int `yaml:"maxHistory"`
+
+	// Storage is the backend thoughts are persisted with: memory, jsonl
+	// or bolt.
+	Storage string `yaml:"storage"`
+	// StoragePath is the directory of the jsonl backend or the database
+	// file of the bolt backend.
+	StoragePath string `yaml:"storagePath"`
+
+	// LogLevel is the minimum level of log records: debug, info, warn or
+	// error.
+	LogLevel string `yaml:"logLevel"`
+	// LogFormat is the format of log records: json or console.
+	LogFormat string `yaml:"logFormat"`
+	// LogFile is the file log records are appended to, stderr if empty.
+	LogFile string `yaml:"logFile"`
+}
+
+func defaultConfig() *Config {
+	return &Config{
+		Name:         "sequential_thinking",
+		Transport:    "stdio",
+		Listen:       "127.0.0.1:8080",
+		Strict:       true,
+		OutputFormat: "emoji",
+		Storage:      "memory",
+		LogLevel:     "info",
+		LogFormat:    "console",
+	}
+}
+
+// loadConfig resolves the configuration from the command-line arguments
+// (without the program name) and the environment. Subcommands pass extra
+// functions to register flags of their own.
+func loadConfig(args []string, getenv func(string) string, extraFlags ...func(*flag.FlagSet)) (*Config, error) {
+	cfg := defaultConfig()
+
+	// Flags are parsed into their own Config first, and only the ones that
+	// were actually given are applied once the file and environment have
+	// been read.
+	flags := *cfg
+	fs := flag.NewFlagSet(cfg.Name, flag.ContinueOnError)
+	configPath := fs.String("config", "", "path to a YAML configuration file (env "+envPrefix+"CONFIG)")
+	fs.StringVar(&flags.Name, "name", flags.Name, "server name reported to clients")
+	fs.StringVar(&flags.Transport, "transport", flags.Transport, "transport to serve MCP over: stdio, sse or http")
+	fs.StringVar(&flags.Listen, "listen", flags.Listen, "address to listen on for the sse and http transports")
+	fs.Func("allowed-origins", "comma-separated browser origins accepted besides loopback ones, * for any", func(v string) error {
+		flags.AllowedOrigins = splitList(v)
+		return nil
+	})
+	fs.BoolVar(&flags.DisableThoughtLogging, "disable-thought-logging", flags.DisableThoughtLogging, "replace formatted thoughts in responses with a notice")
+	fs.BoolVar(&flags.ExtendTotal, "extend-total", flags.ExtendTotal, "raise totalThoughts instead of rejecting thoughts beyond it")
+	fs.BoolVar(&flags.Strict, "strict", flags.Strict, "reject unknown arguments and values of the wrong type instead of ignoring them and parsing numbers and booleans sent as strings")
+	fs.StringVar(&flags.OutputFormat, "output-format", flags.OutputFormat, "how to render responses: "+strings.Join(renderFormats, ", "))
+	fs.IntVar(&flags.MaxHistory, "max-history", flags.MaxHistory, "maximum number of thoughts per session, 0 for no limit")
+	fs.StringVar(&flags.Storage, "storage", flags.Storage, "backend to persist thoughts with: memory, jsonl or bolt")
+	fs.StringVar(&flags.StoragePath, "storage-path", flags.StoragePath, "directory of the jsonl backend or database file of the bolt backend")
+	fs.StringVar(&flags.LogLevel, "log-level", flags.LogLevel, "minimum log level: debug, info, warn or error")
+	fs.StringVar(&flags.LogFormat, "log-format", flags.LogFormat, "log format: json or console")
+	fs.StringVar(&flags.LogFile, "log-file", flags.LogFile, "file to append logs to instead of stderr")
+	for _, register := range extraFlags {
+		register(fs)
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	path := *configPath
+	if path == "" {
+		path = getenv(envPrefix + "CONFIG")
+	}
+	if path != "" {
+		if err := cfg.loadFile(path); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := cfg.loadEnv(getenv); err != nil {
+		return nil, err
+	}
+
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "name":
+			cfg.Name = flags.Name
+		case "transport":
+			cfg.Transport = flags.Transport
+		case "listen":
+			cfg.Listen = flags.Listen
+		case "allowed-origins":
+			cfg.AllowedOrigins = flags.AllowedOrigins
+		case "disable-thought-logging":
+			cfg.DisableThoughtLogging = flags.DisableThoughtLogging
+		case "extend-total":
+			cfg.ExtendTotal = flags.ExtendTotal
+		case "strict":
+			cfg.Strict = flags.Strict
+		case "output-format":
+			cfg.OutputFormat = flags.OutputFormat
+		case "max-history":
+			cfg.MaxHistory = flags.MaxHistory
+		case "storage":
+			cfg.Storage = flags.Storage
+		case "storage-path":
+			cfg.StoragePath = flags.StoragePath
+		case "log-level":
+			cfg.LogLevel = flags.LogLevel
+		case "log-format":
+			cfg.LogFormat = flags.LogFormat
+		case "log-file":
+			cfg.LogFile = flags.LogFile
+		}
+	})
+
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+func (c *Config) loadFile(path string) error {
+	f, err := os.Open(path) //nolint:gosec // G304: the operator picks the config file
+	if err != nil {
+		return fmt.Errorf("failed to open config file: %v", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	dec := yaml.NewDecoder(f)
+	dec.KnownFields(true)
+	if err := dec.Decode(c); err != nil && err != io.EOF {
+		return fmt.Errorf("failed to parse config file %s: %v", path, err)
+	}
+	return nil
+}
+
+func (c *Config) loadEnv(getenv func(string) string) error {
+	// DISABLE_THOUGHT_LOGGING predates the prefixed variables and is
+	// still honoured.
+	if v := getenv("DISABLE_THOUGHT_LOGGING"); v != "" {
+		c.DisableThoughtLogging = v == "true"
+	}
+
+	if v := getenv(envPrefix + "NAME"); v != "" {
+		c.Name = v
+	}
+	if v := getenv(envPrefix + "TRANSPORT"); v != "" {
+		c.Transport = v
+	}
+	if v := getenv(envPrefix + "LISTEN"); v != "" {
+		c.Listen = v
+	}
+	if v := getenv(envPrefix + "ALLOWED_ORIGINS"); v != "" {
+		c.AllowedOrigins = splitList(v)
+	}
+	if v := getenv(envPrefix + "OUTPUT_FORMAT"); v != "" {
+		c.OutputFormat = v
+	}
+	if v := getenv(envPrefix + "STORAGE"); v != "" {
+		c.Storage = v
+	}
+	if v := getenv(envPrefix + "STORAGE_PATH"); v != "" {
+		c.StoragePath = v
+	}
+	if v := getenv(envPrefix + "LOG_LEVEL"); v != "" {
+		c.LogLevel = v
+	}
+	if v := getenv(envPrefix + "LOG_FORMAT"); v != "" {
+		c.LogFormat = v
+	}
+	if v := getenv(envPrefix + "LOG_FILE"); v != "" {
+		c.LogFile = v
+	}
+
+	bools := map[string]*bool{
+		"DISABLE_THOUGHT_LOGGING": &c.DisableThoughtLogging,
+		"EXTEND_TOTAL":            &c.ExtendTotal,
+		"STRICT":                  &c.Strict,
+	}
+	for name, field := range bools {
+		v := getenv(envPrefix + name)
+		if v == "" {
+			continue
+		}
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("invalid %s%s: %q is not a boolean", envPrefix, name, v)
+		}
+		*field = b
+	}
+
+	if v := getenv(envPrefix + "MAX_HISTORY"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("invalid %sMAX_HISTORY: %q is not a number", envPrefix, v)
+		}
+		c.MaxHistory = n
+	}
+
+	return nil
+}
+
+func (c *Config) validate() error {
+	if c.Name == "" {
+		return fmt.Errorf("invalid config: name cannot be empty")
+	}
+
+	switch c.Transport {
+	case "stdio":
+	case "sse", "http":
+		if c.Listen == "" {
+			return fmt.Errorf("invalid config: listen address is required for the %s transport", c.Transport)
+		}
+	default:
+		return fmt.Errorf("invalid config: unknown transport %q, expected stdio, sse or http", c.Transport)
+	}
+
+	for _, origin := range c.AllowedOrigins {
+		if origin == "*" {
+			continue
+		}
+		if u, err := url.Parse(origin); err != nil || u.Scheme == "" || u.Host == "" || u.Path != "" {
+			return fmt.Errorf("invalid config: allowed origin %q is not of the form scheme://host[:port]", origin)
+		}
+	}
+
+	if _, err := rendererFor(c.OutputFormat); err != nil {
+		return fmt.Errorf("invalid config: %v", err)
+	}
+
+	if c.MaxHistory < 0 {
+		return fmt.Errorf("invalid config: maxHistory cannot be negative")
+	}
+
+	switch c.Storage {
+	case "memory":
+	case "jsonl", "bolt":
+		if c.StoragePath == "" {
+			return fmt.Errorf("invalid config: storagePath is required for the %s storage", c.Storage)
+		}
+	default:
+		return fmt.Errorf("invalid config: unknown storage %q, expected memory, jsonl or bolt", c.Storage)
+	}
+
+	if !validLogLevel(c.LogLevel) {
+		return fmt.Errorf("invalid config: unknown log level %q, expected debug, info, warn or error", c.LogLevel)
+	}
+	if c.LogFormat != "json" && c.LogFormat != "console" {
+		return fmt.Errorf("invalid config: unknown log format %q, expected json or console", c.LogFormat)
+	}
+
+	return nil
+}
+
+// splitList splits a comma-separated setting, dropping empty items.
+func splitList(v string) []string {
+	var items []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// Options returns the tool options described by the configuration.
+func (c *Config) Options() Options {
+	return Options{
+		ExtendTotal:           c.ExtendTotal,
+		DisableThoughtLogging: c.DisableThoughtLogging,
+		Strict:                c.Strict,
+		Format:                c.OutputFormat,
+	}
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func envFrom(vars map[string]string) func(string) string {
+	return func(key string) string { return vars[key] }
+}
+
+func writeConfigFile(t *testing.T, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	return path
+}
+
+func TestLoadConfig(t *testing.T) {
+	t.Run("defaults", func(t *testing.T) {
+		cfg, err := loadConfig(nil, envFrom(nil))
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if !reflect.DeepEqual(cfg, defaultConfig()) {
+			t.Errorf("Expected default config, got %+v", cfg)
+		}
+		if cfg.Listen != "127.0.0.1:8080" {
+			t.Errorf("Expected to listen on loopback by default, got %s", cfg.Listen)
+		}
+	})
+
+	t.Run("allowed origins", func(t *testing.T) {
+		path := writeConfigFile(t, "allowedOrigins: [\"https://file.example\"]\n")
+		want := []string{"https://app.example", "http://app.example:3000"}
+
+		cfg, err := loadConfig(
+			[]string{"--config", path},
+			envFrom(map[string]string{"SEQUENTIAL_THINKING_ALLOWED_ORIGINS": "https://app.example, http://app.example:3000,"}),
+		)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if !reflect.DeepEqual(cfg.AllowedOrigins, want) {
+			t.Errorf("Expected origins from environment %q, got %q", want, cfg.AllowedOrigins)
+		}
+
+		cfg, err = loadConfig([]string{"--config", path, "--allowed-origins=*"}, envFrom(nil))
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if !reflect.DeepEqual(cfg.AllowedOrigins, []string{"*"}) {
+			t.Errorf("Expected origins from flag, got %q", cfg.AllowedOrigins)
+		}
+	})
+
+	t.Run("flags override environment override file", func(t *testing.T) {
+		path := writeConfigFile(t, "transport: sse\nlisten: \":9000\"\nmaxHistory: 10\nname: from-file\nlogFormat: json\n")
+
+		cfg, err := loadConfig(
+			[]string{"--config", path, "--transport=http"},
+			envFrom(map[string]string{
+				"SEQUENTIAL_THINKING_TRANSPORT":   "stdio",
+				"SEQUENTIAL_THINKING_MAX_HISTORY": "20",
+				"SEQUENTIAL_THINKING_LOG_LEVEL":   "debug",
+			}),
+		)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		if cfg.Transport != "http" {
+			t.Errorf("Expected transport from flag, got %s", cfg.Transport)
+		}
+		if cfg.MaxHistory != 20 {
+			t.Errorf("Expected maxHistory from environment, got %d", cfg.MaxHistory)
+		}
+		if cfg.LogLevel != "debug" || cfg.LogFormat != "json" {
+			t.Errorf("Expected log settings from environment and file, got %s %s", cfg.LogLevel, cfg.LogFormat)
+		}
+		if cfg.Listen != ":9000" || cfg.Name != "from-file" {
+			t.Errorf("Expected listen and name from file, got %s %s", cfg.Listen, cfg.Name)
+		}
+	})
+
+	t.Run("config file from environment", func(t *testing.T) {
+		path := writeConfigFile(t, "extendTotal: true\n")
+
+		cfg, err := loadConfig(nil, envFrom(map[string]string{"SEQUENTIAL_THINKING_CONFIG": path}))
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if !cfg.ExtendTotal || !cfg.Options().ExtendTotal {
+			t.Error("Expected extendTotal = true from file")
+		}
+	})
+
+	t.Run("extension mode is off by default", func(t *testing.T) {
+		cfg, err := loadConfig(nil, envFrom(nil))
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if cfg.ExtendTotal || cfg.Options().ExtendTotal {
+			t.Error("Expected thoughts beyond totalThoughts to be rejected by default")
+		}
+	})
+
+	t.Run("legacy DISABLE_THOUGHT_LOGGING", func(t *testing.T) {
+		cfg, err := loadConfig(nil, envFrom(map[string]string{"DISABLE_THOUGHT_LOGGING": "true"}))
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if !cfg.DisableThoughtLogging || !cfg.Options().DisableThoughtLogging {
+			t.Error("Expected thought logging to be disabled")
+		}
+	})
+
+	t.Run("strict mode can be turned off", func(t *testing.T) {
+		cfg, err := loadConfig([]string{"--strict=false"}, envFrom(nil))
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if cfg.Strict || cfg.Options().Strict {
+			t.Error("Expected strict mode to be off")
+		}
+		if !defaultConfig().Options().Strict {
+			t.Error("Expected strict mode to be on by default")
+		}
+	})
+
+	t.Run("invalid settings", func(t *testing.T) {
+		testCases := []struct {
+			name    string
+			args    []string
+			env     map[string]string
+			file    string
+			wantErr string
+		}{
+			{name: "unknown transport", args: []string{"--transport=pigeon"}, wantErr: "unknown transport"},
+			{name: "empty listen", args: []string{"--transport=http", "--listen="}, wantErr: "listen address is required"},
+			{name: "bad allowed origin", args: []string{"--allowed-origins=app.example"}, wantErr: "is not of the form scheme://host[:port]"},
+			{name: "negative history", args: []string{"--max-history=-1"}, wantErr: "maxHistory cannot be negative"},
+			{name: "bad boolean", env: map[string]string{"SEQUENTIAL_THINKING_EXTEND_TOTAL": "maybe"}, wantErr: "is not a boolean"},
+			{name: "bad number", env: map[string]string{"SEQUENTIAL_THINKING_MAX_HISTORY": "lots"}, wantErr: "is not a number"},
+			{name: "unknown output format", args: []string{"--output-format=html"}, wantErr: "unknown format"},
+			{name: "unknown storage", args: []string{"--storage=tape"}, wantErr: "unknown storage"},
+			{name: "storage without path", env: map[string]string{"SEQUENTIAL_THINKING_STORAGE": "jsonl"}, wantErr: "storagePath is required"},
+			{name: "unknown log level", args: []string{"--log-level=loud"}, wantErr: "unknown log level"},
+			{name: "unknown log format", env: map[string]string{"SEQUENTIAL_THINKING_LOG_FORMAT": "xml"}, wantErr: "unknown log format"},
+			{name: "unknown file key", file: "transprot: http\n", wantErr: "failed to parse config file"},
+			{name: "unknown flag", args: []string{"--nope"}, wantErr: "flag provided but not defined"},
+		}
+
+		for _, tc := range testCases {
+			t.Run(tc.name, func(t *testing.T) {
+				args := tc.args
+				if tc.file != "" {
+					args = append(args, "--config", writeConfigFile(t, tc.file))
+				}
+
+				_, err := loadConfig(args, envFrom(tc.env))
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Errorf("Expected error containing '%s', got %v", tc.wantErr, err)
+				}
+			})
+		}
+	})
+}
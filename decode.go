@@ -0,0 +1,431 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/go-viper/mapstructure/v2"
+)
+
+// thoughtValidator checks the validate tags of ThoughtData. It is shared by
+// every call, since a validator caches what it learns about a struct type.
+// Errors name fields by their argument names.
+var thoughtValidator = func() *validator.Validate {
+	v := validator.New()
+	v.RegisterTagNameFunc(func(f reflect.StructField) string {
+		return f.Tag.Get("mapstructure")
+	})
+	return v
+}()
+
+// thoughtField decodes one argument of the sequential thinking tool. set
+// returns false when the value is not of a type it handles, and want
+// describes the values it expects.
+type thoughtField struct {
+	set  func(data *ThoughtData, v any) bool
+	want string
+}
+
+// thoughtFields maps the argument names of the sequential thinking tool to
+// their decoders. It mirrors the mapstructure tags of ThoughtData, which
+// init checks.
+var thoughtFields = map[string]thoughtField{
+	"thought":           {stringField(func(d *ThoughtData) *string { return &d.Thought }), "a string"},
+	"thoughtNumber":     {intField(func(d *ThoughtData) *int { return &d.ThoughtNumber }), "an integer"},
+	"totalThoughts":     {intField(func(d *ThoughtData) *int { return &d.TotalThoughts }), "an integer"},
+	"isRevision":        {boolPtrField(func(d *ThoughtData) **bool { return &d.IsRevision }), "a boolean"},
+	"revisesThought":    {intPtrField(func(d *ThoughtData) **int { return &d.RevisesThought }), "an integer"},
+	"branchFromThought": {intPtrField(func(d *ThoughtData) **int { return &d.BranchFromThought }), "an integer"},
+	"branchId":          {stringField(func(d *ThoughtData) *string { return &d.BranchID }), "a string"},
+	"mergeBranch":       {stringField(func(d *ThoughtData) *string { return &d.MergeBranch }), "a string"},
+	"branchState":       {stringField(func(d *ThoughtData) *string { return (*string)(&d.BranchState) }), "a string"},
+	"branchReason":      {stringField(func(d *ThoughtData) *string { return &d.BranchReason }), "a string"},
+	"needsMoreThoughts": {boolPtrField(func(d *ThoughtData) **bool { return &d.NeedsMoreThoughts }), "a boolean"},
+	"nextThoughtNeeded": {boolPtrField(func(d *ThoughtData) **bool { return &d.NextThoughtNeeded }), "a boolean"},
+	"sessionId":         {stringField(func(d *ThoughtData) *string { return &d.SessionID }), "a string"},
+	"format":            {stringField(func(d *ThoughtData) *string { return &d.Format }), "a string"},
+}
+
+// thoughtFieldNames lists the keys of thoughtFields in order.
+var thoughtFieldNames = func() []string {
+	names := make([]string, 0, len(thoughtFields))
+	for name := range thoughtFields {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}()
+
+func init() {
+	t := reflect.TypeOf(ThoughtData{})
+	tagged := 0
+	for i := range t.NumField() {
+		name := t.Field(i).Tag.Get("mapstructure")
+		if name == "" || name == "-" {
+			continue
+		}
+		if _, ok := thoughtFields[name]; !ok {
+			panic(fmt.Sprintf("thoughtFields has no decoder for %s", name))
+		}
+		tagged++
+	}
+	if tagged != len(thoughtFields) {
+		panic("thoughtFields decodes arguments that ThoughtData does not have")
+	}
+
+	// Let the validator parse the tags now rather than on the first call.
+	_ = thoughtValidator.Struct(&ThoughtData{Thought: "-", ThoughtNumber: 1, TotalThoughts: 1})
+}
+
+// decodeThoughtData decodes and validates the arguments of the sequential
+// thinking tool. Arguments of the types JSON decoding produces are decoded by
+// thoughtFields; anything else goes through mapstructure, which also words
+// the errors. Numbers and booleans sent as strings, such as "3" and "true",
+// are coerced. Unknown arguments are ignored.
+func decodeThoughtData(args map[string]any) (ThoughtData, error) {
+	var data ThoughtData
+	for name, v := range args {
+		field, ok := thoughtFields[name]
+		if !ok || v == nil {
+			continue
+		}
+		if !field.set(&data, v) {
+			return decodeThoughtDataReflect(args)
+		}
+	}
+
+	if data.Thought == "" || data.ThoughtNumber < 1 || data.TotalThoughts < 1 {
+		if err := thoughtValidator.Struct(&data); err != nil {
+			return ThoughtData{}, &InputError{Summary: "validation failed", Fields: validatorFieldErrors(err, args)}
+		}
+	}
+	return data, nil
+}
+
+// decodeThoughtDataReflect is the general decoding path, built on
+// mapstructure and the validate tags.
+func decodeThoughtDataReflect(args map[string]any) (ThoughtData, error) {
+	var data ThoughtData
+	if err := decodeWeakly(args, &data); err != nil {
+		return ThoughtData{}, &InputError{Summary: "failed to decode input", Fields: decodeFieldErrors(args, err)}
+	}
+	if err := thoughtValidator.Struct(&data); err != nil {
+		return ThoughtData{}, &InputError{Summary: "validation failed", Fields: validatorFieldErrors(err, args)}
+	}
+	return data, nil
+}
+
+// decodeFieldErrors finds the arguments mapstructure could not decode, by
+// decoding them one at a time. err is reported as is if none fails alone.
+func decodeFieldErrors(args map[string]any, err error) []FieldError {
+	var fields []FieldError
+	for _, name := range thoughtFieldNames {
+		v, ok := args[name]
+		if !ok || v == nil {
+			continue
+		}
+		var probe ThoughtData
+		if decodeWeakly(map[string]any{name: v}, &probe) != nil {
+			fields = append(fields, typeError(name, thoughtFields[name].want, v))
+		}
+	}
+	if len(fields) == 0 {
+		fields = append(fields, FieldError{Rule: "type", Message: err.Error()})
+	}
+	return fields
+}
+
+// decodeWeakly decodes args into data with mapstructure, parsing strings
+// given for integers and booleans. Other values are left as they are, so a
+// number is still rejected as a thought.
+func decodeWeakly(args map[string]any, data *ThoughtData) error {
+	dec, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		DecodeHook: mapstructure.DecodeHookFuncKind(func(from, to reflect.Kind, v any) (any, error) {
+			s, ok := v.(string)
+			if !ok || from != reflect.String {
+				return v, nil
+			}
+			switch to {
+			case reflect.Int:
+				if n, err := strconv.Atoi(strings.TrimSpace(s)); err == nil {
+					return n, nil
+				}
+			case reflect.Bool:
+				if b, err := strconv.ParseBool(strings.TrimSpace(s)); err == nil {
+					return b, nil
+				}
+			}
+			return v, nil
+		}),
+		Result: data,
+	})
+	if err != nil {
+		return err
+	}
+	return dec.Decode(args)
+}
+
+// validatorFieldErrors translates the errors of thoughtValidator. The
+// required rule also fails for zeros that were given, which are reported as
+// below the minimum instead.
+func validatorFieldErrors(err error, args map[string]any) []FieldError {
+	var verrs validator.ValidationErrors
+	if !errors.As(err, &verrs) {
+		return []FieldError{{Message: err.Error()}}
+	}
+
+	fields := make([]FieldError, 0, len(verrs))
+	for _, fe := range verrs {
+		name := fe.Field()
+		n, isInt := fe.Value().(int)
+		switch {
+		case fe.Tag() == "min" && isInt, fe.Tag() == "required" && isInt && args[name] != nil:
+			fields = append(fields, minError(name, n))
+		case fe.Tag() == "required":
+			fields = append(fields, requiredError(name))
+		default:
+			fields = append(fields, FieldError{
+				Field:   name,
+				Rule:    fe.Tag(),
+				Message: fmt.Sprintf("%s fails the %s rule", name, fe.Tag()),
+				Value:   fe.Value(),
+			})
+		}
+	}
+	return fields
+}
+
+// decodeThoughtDataStrict decodes the arguments of the sequential thinking
+// tool without coercing values or ignoring unknown arguments. Values must be
+// of the JSON type the input schema declares, and integers must be whole
+// numbers. Null values count as missing.
+func decodeThoughtDataStrict(args map[string]any) (ThoughtData, error) {
+	var data ThoughtData
+	var fields []FieldError
+
+	names := make([]string, 0, len(args))
+	for name := range args {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	for _, name := range names {
+		v := args[name]
+		field, ok := thoughtFields[name]
+		if !ok {
+			fe := FieldError{Field: name, Rule: "unknown", Message: fmt.Sprintf("unknown field %q", name), Value: v}
+			if suggestion := suggestField(name); suggestion != "" {
+				fe.Hint = fmt.Sprintf("did you mean %q?", suggestion)
+			}
+			fields = append(fields, fe)
+			continue
+		}
+		if v == nil {
+			continue
+		}
+		if !field.set(&data, v) {
+			fields = append(fields, typeError(name, field.want, v))
+		}
+	}
+
+	if data.Thought == "" && !hasField(fields, "thought") {
+		fields = append(fields, requiredError("thought"))
+	}
+	for _, f := range []struct {
+		name  string
+		value *int
+	}{
+		{"thoughtNumber", &data.ThoughtNumber},
+		{"totalThoughts", &data.TotalThoughts},
+		{"revisesThought", data.RevisesThought},
+		{"branchFromThought", data.BranchFromThought},
+	} {
+		switch {
+		case hasField(fields, f.name):
+		case f.value == nil:
+		case *f.value == 0 && args[f.name] == nil:
+			fields = append(fields, requiredError(f.name))
+		case *f.value < 1:
+			fields = append(fields, minError(f.name, *f.value))
+		}
+	}
+
+	if len(fields) > 0 {
+		return ThoughtData{}, &InputError{Summary: "invalid input", Fields: fields}
+	}
+	return data, nil
+}
+
+func hasField(fields []FieldError, name string) bool {
+	for _, f := range fields {
+		if f.Field == name {
+			return true
+		}
+	}
+	return false
+}
+
+// suggestField returns the known argument closest to an unknown one, or ""
+// if none is close enough to be a likely typo. Case, underscores and dashes
+// are ignored, so that branch_id suggests branchId.
+func suggestField(name string) string {
+	normalize := func(s string) string {
+		return strings.ToLower(strings.NewReplacer("_", "", "-", "").Replace(s))
+	}
+
+	target := normalize(name)
+	best, bestDistance, bestPrefix := "", max(1, len(target)/3)+1, 0
+	for _, known := range thoughtFieldNames {
+		candidate := normalize(known)
+		d, prefix := editDistance(target, candidate), commonPrefix(target, candidate)
+		// Ties go to the longer common prefix, so that thoughtNum
+		// suggests thoughtNumber rather than thought.
+		if d < bestDistance || (best != "" && d == bestDistance && prefix > bestPrefix) {
+			best, bestDistance, bestPrefix = known, d, prefix
+		}
+	}
+	return best
+}
+
+func commonPrefix(a, b string) int {
+	n := 0
+	for n < len(a) && n < len(b) && a[n] == b[n] {
+		n++
+	}
+	return n
+}
+
+// editDistance returns the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
+}
+
+// describeValue names the JSON type of v for error messages, with the value
+// itself where it is short.
+func describeValue(v any) string {
+	switch v := v.(type) {
+	case string:
+		if len(v) > 20 {
+			return "a string"
+		}
+		return fmt.Sprintf("the string %q", v)
+	case bool:
+		return fmt.Sprintf("the boolean %v", v)
+	case float64, float32, int, int64, json.Number:
+		return fmt.Sprintf("the number %v", v)
+	case []any:
+		return "an array"
+	case map[string]any:
+		return "an object"
+	}
+	return fmt.Sprintf("a %T", v)
+}
+
+// typeHint suggests how to fix a value of the wrong type, for the common case
+// of numbers and booleans sent as strings.
+func typeHint(want string, v any) string {
+	s, ok := v.(string)
+	if !ok {
+		return ""
+	}
+	switch want {
+	case "an integer":
+		if n, err := strconv.Atoi(strings.TrimSpace(s)); err == nil {
+			return fmt.Sprintf("send %d as a number, not a string", n)
+		}
+	case "a boolean":
+		if b, err := strconv.ParseBool(strings.TrimSpace(s)); err == nil {
+			return fmt.Sprintf("send %v as a boolean, not a string", b)
+		}
+	}
+	return ""
+}
+
+func stringField(field func(*ThoughtData) *string) func(*ThoughtData, any) bool {
+	return func(data *ThoughtData, v any) bool {
+		s, ok := v.(string)
+		if ok {
+			*field(data) = s
+		}
+		return ok
+	}
+}
+
+func intField(field func(*ThoughtData) *int) func(*ThoughtData, any) bool {
+	return func(data *ThoughtData, v any) bool {
+		n, ok := asInt(v)
+		if ok {
+			*field(data) = n
+		}
+		return ok
+	}
+}
+
+func intPtrField(field func(*ThoughtData) **int) func(*ThoughtData, any) bool {
+	return func(data *ThoughtData, v any) bool {
+		n, ok := asInt(v)
+		if ok {
+			*field(data) = &n
+		}
+		return ok
+	}
+}
+
+func boolPtrField(field func(*ThoughtData) **bool) func(*ThoughtData, any) bool {
+	return func(data *ThoughtData, v any) bool {
+		b, ok := v.(bool)
+		if ok {
+			*field(data) = &b
+		}
+		return ok
+	}
+}
+
+// asInt converts the number types arguments arrive as. Fractions and
+// numbers out of range are left to mapstructure.
+func asInt(v any) (int, bool) {
+	switch n := v.(type) {
+	case int:
+		return n, true
+	case int64:
+		if n < math.MinInt || n > math.MaxInt {
+			return 0, false
+		}
+		return int(n), true
+	case float64:
+		if n != math.Trunc(n) || n < math.MinInt32 || n > math.MaxInt32 {
+			return 0, false
+		}
+		return int(n), true
+	case json.Number:
+		i, err := n.Int64()
+		if err != nil {
+			return 0, false
+		}
+		return asInt(i)
+	}
+	return 0, false
+}
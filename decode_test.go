@@ -0,0 +1,296 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDecodeThoughtData(t *testing.T) {
+	// Every case must decode the same way, or fail with the same error, as
+	// the general path.
+	cases := map[string]map[string]any{
+		"required fields": {
+			"thought": "a", "thoughtNumber": 1, "totalThoughts": 3,
+		},
+		"all fields": {
+			"thought": "a", "thoughtNumber": 2, "totalThoughts": 3,
+			"isRevision": true, "revisesThought": 1,
+			"branchFromThought": 1, "branchId": "b",
+			"needsMoreThoughts": false, "nextThoughtNeeded": true,
+			"sessionId": "s", "format": "plain",
+		},
+		"numbers from JSON": {
+			"thought": "a", "thoughtNumber": float64(2), "totalThoughts": float64(3), "revisesThought": float64(1),
+		},
+		"json.Number": {
+			"thought": "a", "thoughtNumber": json.Number("2"), "totalThoughts": json.Number("3"),
+		},
+		"int64": {
+			"thought": "a", "thoughtNumber": int64(2), "totalThoughts": int64(3),
+		},
+		"fraction": {
+			"thought": "a", "thoughtNumber": 2.5, "totalThoughts": 3,
+		},
+		"number as string": {
+			"thought": "a", "thoughtNumber": "2", "totalThoughts": 3,
+		},
+		"thought as number": {
+			"thought": 123, "thoughtNumber": 1, "totalThoughts": 3,
+		},
+		"null optional field": {
+			"thought": "a", "thoughtNumber": 1, "totalThoughts": 3, "revisesThought": nil,
+		},
+		"unknown field": {
+			"thought": "a", "thoughtNumber": 1, "totalThoughts": 3, "thoughtNum": 4,
+		},
+		"missing thought": {
+			"thoughtNumber": 1, "totalThoughts": 3,
+		},
+		"zero thoughtNumber": {
+			"thought": "a", "thoughtNumber": 0, "totalThoughts": 3,
+		},
+		"negative totalThoughts": {
+			"thought": "a", "thoughtNumber": 1, "totalThoughts": -1,
+		},
+	}
+
+	for name, args := range cases {
+		t.Run(name, func(t *testing.T) {
+			got, err := decodeThoughtData(args)
+			want, wantErr := decodeThoughtDataReflect(args)
+
+			if fmt.Sprint(err) != fmt.Sprint(wantErr) {
+				t.Fatalf("error = %v, want %v", err, wantErr)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("decoded %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestThoughtFields(t *testing.T) {
+	// Every argument in the input schema of the tool must be decoded.
+	schema := NewSequentialThinkingTool(NewThoughtStore(), Options{}).GetMcpTool().InputSchema
+	for name := range schema.Properties {
+		if _, ok := thoughtFields[name]; !ok {
+			t.Errorf("no decoder for argument %s", name)
+		}
+	}
+}
+
+var benchmarkArgs = map[string]any{
+	"thought":           "Benchmark test thought",
+	"thoughtNumber":     float64(2),
+	"totalThoughts":     float64(5),
+	"isRevision":        true,
+	"revisesThought":    float64(1),
+	"nextThoughtNeeded": true,
+	"sessionId":         "bench",
+}
+
+func BenchmarkDecodeThoughtData(b *testing.B) {
+	b.Run("fast", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := decodeThoughtData(benchmarkArgs); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("mapstructure", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := decodeThoughtDataReflect(benchmarkArgs); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+// BenchmarkSequentialThinkingLargeHistory measures calls to the tool in a
+// session that has already recorded many thoughts, on the main line and on
+// branches, as in a long agent run.
+func BenchmarkSequentialThinkingLargeHistory(b *testing.B) {
+	for _, size := range []int{1000, 10000} {
+		b.Run(fmt.Sprintf("history=%d", size), func(b *testing.B) {
+			store := NewThoughtStore()
+			handler := NewSequentialThinkingTool(store, Options{ExtendTotal: true, DisableThoughtLogging: true}).Callback
+
+			call := func(args map[string]any) {
+				args["sessionId"] = "bench"
+				if result := handler(args); result.IsError != nil && *result.IsError {
+					b.Fatalf("call failed: %s", resultText(result))
+				}
+			}
+
+			for n := 1; n <= size; n++ {
+				args := map[string]any{
+					"thought":       "Thought",
+					"thoughtNumber": float64(n),
+					"totalThoughts": float64(size),
+				}
+				if n%10 == 0 {
+					args["branchFromThought"] = float64(n - 1)
+					args["branchId"] = fmt.Sprintf("branch-%d", n)
+				}
+				call(args)
+			}
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				n := size + 1 + i
+				// Revise thoughts of the main line, all over the history.
+				target := 1 + i%(size-1)
+				if target%10 == 0 {
+					target--
+				}
+				call(map[string]any{
+					"thought":        "Revision",
+					"thoughtNumber":  float64(n),
+					"totalThoughts":  float64(n),
+					"isRevision":     true,
+					"revisesThought": float64(target),
+				})
+			}
+		})
+	}
+}
+
+func TestDecodeThoughtDataStrict(t *testing.T) {
+	valid := func(extra map[string]any) map[string]any {
+		args := map[string]any{"thought": "a", "thoughtNumber": float64(1), "totalThoughts": float64(3)}
+		for k, v := range extra {
+			args[k] = v
+		}
+		return args
+	}
+
+	t.Run("accepts JSON types", func(t *testing.T) {
+		data, err := decodeThoughtDataStrict(valid(map[string]any{
+			"thoughtNumber": float64(2), "isRevision": true, "revisesThought": json.Number("1"), "branchId": nil,
+		}))
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if data.ThoughtNumber != 2 || data.RevisesThought == nil || *data.RevisesThought != 1 {
+			t.Errorf("Unexpected data %+v", data)
+		}
+	})
+
+	testCases := []struct {
+		name string
+		args map[string]any
+		want []FieldError
+	}{
+		{
+			name: "unknown field with typo",
+			args: valid(map[string]any{"thoughtNum": float64(2)}),
+			want: []FieldError{{Field: "thoughtNum", Rule: "unknown", Message: `unknown field "thoughtNum"`, Value: float64(2), Hint: `did you mean "thoughtNumber"?`}},
+		},
+		{
+			name: "snake case",
+			args: valid(map[string]any{"branch_id": "b"}),
+			want: []FieldError{{Field: "branch_id", Rule: "unknown", Message: `unknown field "branch_id"`, Value: "b", Hint: `did you mean "branchId"?`}},
+		},
+		{
+			name: "unknown field without suggestion",
+			args: valid(map[string]any{"confidence": 0.9}),
+			want: []FieldError{{Field: "confidence", Rule: "unknown", Message: `unknown field "confidence"`, Value: 0.9}},
+		},
+		{
+			name: "number as string",
+			args: valid(map[string]any{"thoughtNumber": "3"}),
+			want: []FieldError{{Field: "thoughtNumber", Rule: "type", Message: `thoughtNumber must be an integer, got the string "3"`, Value: "3", Hint: "send 3 as a number, not a string"}},
+		},
+		{
+			name: "boolean as string",
+			args: valid(map[string]any{"isRevision": "true"}),
+			want: []FieldError{{Field: "isRevision", Rule: "type", Message: `isRevision must be a boolean, got the string "true"`, Value: "true", Hint: "send true as a boolean, not a string"}},
+		},
+		{
+			name: "fraction",
+			args: valid(map[string]any{"totalThoughts": 2.5}),
+			want: []FieldError{{Field: "totalThoughts", Rule: "type", Message: "totalThoughts must be an integer, got the number 2.5", Value: 2.5}},
+		},
+		{
+			name: "missing and out of range",
+			args: map[string]any{"thoughtNumber": float64(0), "revisesThought": float64(-1)},
+			want: []FieldError{
+				{Field: "thought", Rule: "required", Message: "thought is required"},
+				{Field: "thoughtNumber", Rule: "min", Message: "thoughtNumber must be at least 1, got 0", Value: 0},
+				{Field: "totalThoughts", Rule: "required", Message: "totalThoughts is required"},
+				{Field: "revisesThought", Rule: "min", Message: "revisesThought must be at least 1, got -1", Value: -1},
+			},
+		},
+		{
+			name: "every problem at once",
+			args: map[string]any{"thought": 1, "thoughtNumber": float64(1), "totalThoughts": float64(1), "sesionId": "s"},
+			want: []FieldError{
+				{Field: "sesionId", Rule: "unknown", Message: `unknown field "sesionId"`, Value: "s", Hint: `did you mean "sessionId"?`},
+				{Field: "thought", Rule: "type", Message: "thought must be a string, got the number 1", Value: 1},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := decodeThoughtDataStrict(tc.args)
+			var inputErr *InputError
+			if !errors.As(err, &inputErr) {
+				t.Fatalf("Expected an InputError, got %v", err)
+			}
+			if !reflect.DeepEqual(inputErr.Fields, tc.want) {
+				t.Errorf("Fields = %+v, want %+v", inputErr.Fields, tc.want)
+			}
+		})
+	}
+}
+
+func TestStrictValidationResult(t *testing.T) {
+	handler := NewSequentialThinkingTool(NewThoughtStore(), Options{Strict: true}).Callback
+
+	result := handler(map[string]any{"thought": "a", "thoughtNumber": float64(1), "totalThoughts": float64(1), "branch_id": "b"})
+	if result.IsError == nil || !*result.IsError {
+		t.Fatal("Expected an error result")
+	}
+	if text := resultText(result); !strings.Contains(text, `did you mean "branchId"?`) {
+		t.Errorf("Expected a suggestion in %q", text)
+	}
+	fields, ok := result.Meta["errors"].([]FieldError)
+	if !ok || len(fields) != 1 || fields[0].Field != "branch_id" {
+		t.Errorf("Expected the field error in the meta, got %v", result.Meta)
+	}
+
+	lax := NewSequentialThinkingTool(NewThoughtStore(), Options{}).Callback
+	if result := lax(map[string]any{"thought": "a", "thoughtNumber": float64(1), "totalThoughts": float64(1), "branch_id": "b"}); result.IsError != nil && *result.IsError {
+		t.Errorf("Expected unknown fields to be ignored without strict mode, got %s", resultText(result))
+	}
+}
+
+func TestDecodeThoughtDataCoercion(t *testing.T) {
+	data, err := decodeThoughtData(map[string]any{
+		"thought": "a", "thoughtNumber": "2", "totalThoughts": float64(3),
+		"isRevision": "true", "revisesThought": "1", "nextThoughtNeeded": "false",
+	})
+	if err != nil {
+		t.Fatalf("Expected strings to be coerced, got %v", err)
+	}
+	if data.ThoughtNumber != 2 || data.IsRevision == nil || !*data.IsRevision ||
+		data.RevisesThought == nil || *data.RevisesThought != 1 ||
+		data.NextThoughtNeeded == nil || *data.NextThoughtNeeded {
+		t.Errorf("Unexpected data %+v", data)
+	}
+
+	_, err = decodeThoughtData(map[string]any{"thought": "a", "thoughtNumber": "two", "totalThoughts": float64(3)})
+	var inputErr *InputError
+	if !errors.As(err, &inputErr) || len(inputErr.Fields) != 1 || inputErr.Fields[0].Field != "thoughtNumber" {
+		t.Errorf("Expected a type error for thoughtNumber, got %v", err)
+	}
+}
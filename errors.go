@@ -0,0 +1,103 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// FieldError describes why an argument was rejected, in a form clients can
+// act on without parsing messages.
+type FieldError struct {
+	// Field is the name of the argument.
+	Field string `json:"field"`
+	// Rule names the check that failed:
+	//   - unknown: the argument does not exist
+	//   - type: the value is not of the declared type
+	//   - required: the argument is missing
+	//   - min: the value is below the minimum
+	//   - enum: the value is not one of the allowed ones
+	//   - pattern: the value does not have the allowed form
+	//   - reserved: the value has a special meaning and cannot be used
+	//   - total: the thought is beyond totalThoughts
+	//   - earlier: the value must refer to an earlier thought
+	//   - exists: the value refers to a thought or branch that was not recorded
+	//   - line: the revised thought is not on the line of thought of the revision
+	//   - conflict: the value contradicts what the session recorded
+	//   - state: the branch does not take thoughts in its current state
+	//   - limit: the session reached the history limit
+	//   - storage: the thought could not be persisted
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+	// Value is the value given for the argument, if any.
+	Value any `json:"value,omitempty"`
+	// Hint suggests how to correct the argument, if there is a likely fix.
+	Hint string `json:"hint,omitempty"`
+}
+
+// InputError is returned for rejected arguments. It lists every rejected
+// argument, so that callers can correct them all at once.
+type InputError struct {
+	// Summary leads the message, if set.
+	Summary string
+	Fields  []FieldError
+}
+
+// fieldError returns an InputError for a single argument.
+func fieldError(fe FieldError) *InputError {
+	return &InputError{Fields: []FieldError{fe}}
+}
+
+func (e *InputError) Error() string {
+	msgs := make([]string, len(e.Fields))
+	for i, f := range e.Fields {
+		msgs[i] = f.Message
+		if f.Hint != "" {
+			msgs[i] += " (" + f.Hint + ")"
+		}
+	}
+	msg := strings.Join(msgs, "; ")
+	if e.Summary == "" {
+		return msg
+	}
+	return e.Summary + ": " + msg
+}
+
+// fieldErrors returns the rejected arguments err lists, or an empty list if
+// it is not an InputError.
+func fieldErrors(err error) []FieldError {
+	var inputErr *InputError
+	if errors.As(err, &inputErr) {
+		return inputErr.Fields
+	}
+	return []FieldError{}
+}
+
+func requiredError(name string) FieldError {
+	return FieldError{Field: name, Rule: "required", Message: name + " is required"}
+}
+
+func minError(name string, value int) FieldError {
+	return FieldError{
+		Field:   name,
+		Rule:    "min",
+		Message: fmt.Sprintf("%s must be at least 1, got %d", name, value),
+		Value:   value,
+	}
+}
+
+func typeError(name, want string, value any) FieldError {
+	return FieldError{
+		Field:   name,
+		Rule:    "type",
+		Message: fmt.Sprintf("%s must be %s, got %s", name, want, describeValue(value)),
+		Value:   value,
+		Hint:    typeHint(want, value),
+	}
+}
+
+// ValidationFailure is the structured content of a rejected thought.
+type ValidationFailure struct {
+	Error  string       `json:"error"`
+	Errors []FieldError `json:"errors"`
+}
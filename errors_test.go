@@ -0,0 +1,189 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// failingPersister fails to store anything.
+type failingPersister struct{}
+
+func (failingPersister) Load() (map[string][]ThoughtData, error) { return nil, nil }
+func (failingPersister) Append(string, ThoughtData) error        { return errors.New("disk full") }
+func (failingPersister) Delete(string) error                     { return nil }
+func (failingPersister) Close() error                            { return nil }
+
+func TestInputError(t *testing.T) {
+	err := &InputError{
+		Summary: "invalid input",
+		Fields: []FieldError{
+			{Field: "thoughtNum", Rule: "unknown", Message: `unknown field "thoughtNum"`, Hint: `did you mean "thoughtNumber"?`},
+			requiredError("thought"),
+		},
+	}
+	want := `invalid input: unknown field "thoughtNum" (did you mean "thoughtNumber"?); thought is required`
+	if err.Error() != want {
+		t.Errorf("Error() = %q, want %q", err.Error(), want)
+	}
+
+	if got := fieldError(minError("totalThoughts", 0)).Error(); got != "totalThoughts must be at least 1, got 0" {
+		t.Errorf("Expected the message alone without a summary, got %q", got)
+	}
+
+	wrapped := fmt.Errorf("wrapped: %w", err)
+	if fields := fieldErrors(wrapped); len(fields) != 2 {
+		t.Errorf("Expected the fields of a wrapped error, got %v", fields)
+	}
+	if fields := fieldErrors(errors.New("plain")); fields == nil || len(fields) != 0 {
+		t.Errorf("Expected an empty list for other errors, got %#v", fields)
+	}
+}
+
+func TestValidationErrors(t *testing.T) {
+	testCases := []struct {
+		name string
+		// setup prepares the store, if set.
+		setup func(t *testing.T, store *ThoughtStore)
+		// prior are thoughts recorded before args.
+		prior []map[string]any
+		args  map[string]any
+		want  FieldError
+	}{
+		{
+			name: "validator required",
+			args: map[string]any{"thoughtNumber": 1, "totalThoughts": 1},
+			want: requiredError("thought"),
+		},
+		{
+			name: "validator zero given",
+			args: map[string]any{"thought": "a", "thoughtNumber": 0, "totalThoughts": 1},
+			want: minError("thoughtNumber", 0),
+		},
+		{
+			name: "undecodable value",
+			args: map[string]any{"thought": "a", "thoughtNumber": 1, "totalThoughts": 1, "branchId": 7},
+			want: typeError("branchId", "a string", 7),
+		},
+		{
+			name: "unknown format",
+			args: map[string]any{"thought": "a", "thoughtNumber": 1, "totalThoughts": 1, "format": "html"},
+			want: FieldError{Field: "format", Rule: "enum", Message: `unknown format "html", expected one of emoji, plain, compact, markdown, json`, Value: "html"},
+		},
+		{
+			name: "beyond total",
+			args: map[string]any{"thought": "a", "thoughtNumber": 4, "totalThoughts": 3},
+			want: FieldError{Field: "thoughtNumber", Rule: "total", Message: "thoughtNumber cannot be greater than totalThoughts", Value: 4, Hint: "raise totalThoughts to at least 4, or set needsMoreThoughts"},
+		},
+		{
+			name: "revision of a later thought",
+			args: map[string]any{"thought": "a", "thoughtNumber": 2, "totalThoughts": 3, "isRevision": true, "revisesThought": 2},
+			want: FieldError{Field: "revisesThought", Rule: "earlier", Message: "thought 2 cannot revise thought 2, only earlier thoughts can be revised", Value: 2},
+		},
+		{
+			name: "unrecorded branch origin",
+			args: map[string]any{"thought": "a", "thoughtNumber": 2, "totalThoughts": 3, "branchFromThought": 1, "branchId": "b"},
+			want: FieldError{Field: "branchFromThought", Rule: "exists", Message: "branchFromThought 1 does not refer to a recorded thought", Value: 1},
+		},
+		{
+			name:  "unknown branch",
+			prior: []map[string]any{{"thought": "a", "thoughtNumber": 1, "totalThoughts": 3}},
+			args:  map[string]any{"thought": "b", "thoughtNumber": 2, "totalThoughts": 3, "branchId": "b"},
+			want:  FieldError{Field: "branchId", Rule: "exists", Message: `branch "b" does not exist, set branchFromThought to start it`, Value: "b", Hint: "set branchFromThought to the thought the branch diverges from"},
+		},
+		{
+			name: "revision off the main line",
+			prior: []map[string]any{
+				{"thought": "a", "thoughtNumber": 1, "totalThoughts": 3},
+				{"thought": "b", "thoughtNumber": 2, "totalThoughts": 3, "branchFromThought": 1, "branchId": "b"},
+			},
+			args: map[string]any{"thought": "c", "thoughtNumber": 3, "totalThoughts": 3, "isRevision": true, "revisesThought": 2},
+			want: FieldError{Field: "revisesThought", Rule: "line", Message: "revisesThought 2 is not on the main line", Value: 2, Hint: "set branchId to revise a thought of a branch"},
+		},
+		{
+			name: "unknown branch state",
+			args: map[string]any{"thought": "a", "thoughtNumber": 1, "totalThoughts": 1, "branchId": "b", "branchState": "won"},
+			want: FieldError{Field: "branchState", Rule: "enum", Message: `unknown branchState "won", expected one of open, abandoned, chosen`, Value: BranchState("won")},
+		},
+		{
+			name: "branch state off a branch",
+			args: map[string]any{"thought": "a", "thoughtNumber": 1, "totalThoughts": 1, "branchState": "chosen"},
+			want: FieldError{Field: "branchId", Rule: "required", Message: "branchState requires branchId", Hint: "set branchId to the branch whose state changes"},
+		},
+		{
+			name: "abandoned without reason",
+			args: map[string]any{"thought": "a", "thoughtNumber": 1, "totalThoughts": 1, "branchId": "b", "branchState": "abandoned"},
+			want: FieldError{Field: "branchReason", Rule: "required", Message: "abandoning a branch requires branchReason", Hint: "say why the branch is given up"},
+		},
+		{
+			name: "thought on an abandoned branch",
+			prior: []map[string]any{
+				{"thought": "a", "thoughtNumber": 1, "totalThoughts": 3},
+				{"thought": "b", "thoughtNumber": 2, "totalThoughts": 3, "branchFromThought": 1, "branchId": "b", "branchState": "abandoned", "branchReason": "too slow"},
+			},
+			args: map[string]any{"thought": "c", "thoughtNumber": 3, "totalThoughts": 3, "branchId": "b"},
+			want: FieldError{Field: "branchId", Rule: "state", Message: `branch "b" was abandoned: too slow`, Value: "b", Hint: "set branchState to open to reopen it"},
+		},
+		{
+			name:  "history limit",
+			setup: func(t *testing.T, store *ThoughtStore) { store.SetHistoryLimit(1) },
+			prior: []map[string]any{{"thought": "a", "thoughtNumber": 1, "totalThoughts": 3}},
+			args:  map[string]any{"thought": "b", "thoughtNumber": 2, "totalThoughts": 3},
+			want:  FieldError{Field: "thoughtNumber", Rule: "limit", Message: `session "default" reached the limit of 1 thoughts`, Value: 2, Hint: "continue in a new session"},
+		},
+		{
+			name: "persistence failure",
+			setup: func(t *testing.T, store *ThoughtStore) {
+				if err := store.Restore(failingPersister{}); err != nil {
+					t.Fatalf("Expected no error, got %v", err)
+				}
+			},
+			args: map[string]any{"thought": "a", "thoughtNumber": 1, "totalThoughts": 1},
+			want: FieldError{Field: "thought", Rule: "storage", Message: "failed to persist thought: disk full", Hint: "the thought was not recorded, send it again"},
+		},
+		{
+			name: "invalid session",
+			args: map[string]any{"thought": "a", "thoughtNumber": 1, "totalThoughts": 1, "sessionId": "no spaces"},
+			want: FieldError{Field: "sessionId", Rule: "pattern", Message: `invalid sessionId "no spaces", use up to 64 letters, digits, '.', '_', ':' or '-'`, Value: "no spaces"},
+		},
+		{
+			name: "reserved session",
+			args: map[string]any{"thought": "a", "thoughtNumber": 1, "totalThoughts": 1, "sessionId": "current"},
+			want: FieldError{Field: "sessionId", Rule: "reserved", Message: `sessionId "current" is reserved for the current session in resource URIs`, Value: "current", Hint: "choose another session ID"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			store := NewThoughtStore()
+			if tc.setup != nil {
+				tc.setup(t, store)
+			}
+			tool := NewSequentialThinkingTool(store, Options{})
+			for _, args := range tc.prior {
+				if result, _ := tool.CallStructured(args); result.IsError != nil && *result.IsError {
+					t.Fatalf("Expected no error, got %s", resultText(result))
+				}
+			}
+
+			result, structured := tool.CallStructured(tc.args)
+			if result.IsError == nil || !*result.IsError {
+				t.Fatal("Expected an error result")
+			}
+			failure, ok := structured.(*ValidationFailure)
+			if !ok {
+				t.Fatalf("Expected a ValidationFailure, got %T", structured)
+			}
+			if len(failure.Errors) != 1 || !reflect.DeepEqual(failure.Errors[0], tc.want) {
+				t.Errorf("Errors = %+v, want [%+v]", failure.Errors, tc.want)
+			}
+			if resultText(result) != "Validation error: "+failure.Error {
+				t.Errorf("Expected the text to carry the message, got %q", resultText(result))
+			}
+			if !reflect.DeepEqual(result.Meta["errors"], failure.Errors) || result.Meta["error"] != failure.Error {
+				t.Errorf("Expected the meta to match the structured content, got %v", result.Meta)
+			}
+		})
+	}
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/strowk/foxy-contexts/pkg/fxctx"
+	"github.com/strowk/foxy-contexts/pkg/mcp"
+)
+
+// exportFormats lists the formats a session can be exported in, the first
+// one being the default.
+var exportFormats = []string{"markdown", "json", "mermaid", "dot"}
+
+// sessionView is the part of a session that is exported: by default its
+// compaction, otherwise the full history.
+type sessionView struct {
+	SessionID string
+	Thoughts  []ThoughtData
+	Branches  []Branch
+	// History is the full history, which graphs are always drawn from.
+	History []ThoughtData
+	// Compaction is set for compacted views.
+	Compaction *Compaction
+}
+
+// viewSession returns the compacted view of a session, or its full history
+// if full is set.
+func viewSession(store *ThoughtStore, sessionID string, full bool) (*sessionView, error) {
+	history := store.History(sessionID)
+	if len(history) == 0 {
+		return nil, fmt.Errorf("session %q has no recorded thoughts", sessionID)
+	}
+
+	view := &sessionView{SessionID: sessionID, Thoughts: history, Branches: store.Branches(sessionID), History: history}
+	if full {
+		return view, nil
+	}
+
+	c := CompactHistory(history)
+	view.Thoughts, view.Compaction = c.Thoughts, c
+	view.Branches = slices.DeleteFunc(view.Branches, func(b Branch) bool {
+		return c.LeftOut(b.ID)
+	})
+	return view, nil
+}
+
+type exporter func(view *sessionView) (string, error)
+
+var exporters = map[string]exporter{
+	"markdown": markdownReport,
+	"json":     jsonExport,
+	"mermaid": func(view *sessionView) (string, error) {
+		return sessionGraph(view).Mermaid(), nil
+	},
+	"dot": func(view *sessionView) (string, error) {
+		return sessionGraph(view).DOT(view.SessionID), nil
+	},
+}
+
+// sessionGraph draws every recorded thought, since the compacted chain alone
+// is a straight line, and highlights the chain of a compacted view.
+func sessionGraph(view *sessionView) *ThoughtGraph {
+	g := NewThoughtGraph(view.History)
+	if view.Compaction != nil {
+		g.Highlight(view.Compaction.Lineage)
+	}
+	return g
+}
+
+// exportSession renders a session in format: its current best chain, or
+// every recorded thought if full is set.
+func exportSession(store *ThoughtStore, sessionID, format string, full bool) (string, error) {
+	export, ok := exporters[format]
+	if !ok {
+		return "", fmt.Errorf("unknown format %q, expected one of %s", format, strings.Join(exportFormats, ", "))
+	}
+
+	view, err := viewSession(store, sessionID, full)
+	if err != nil {
+		return "", err
+	}
+	return export(view)
+}
+
+// markdownReport renders a session as a report that reads like the tool's
+// own responses, one section per thought.
+func markdownReport(view *sessionView) (string, error) {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "# Thought session %s\n\n", view.SessionID)
+	if view.Compaction != nil {
+		b.WriteString(view.Compaction.Summary())
+	} else {
+		fmt.Fprintf(&b, "%d thoughts recorded", len(view.Thoughts))
+	}
+	if len(view.Branches) > 0 {
+		b.WriteString(", branches:")
+		for i, branch := range view.Branches {
+			if i > 0 {
+				b.WriteString(",")
+			}
+			fmt.Fprintf(&b, " `%s` from thought %d (%d thoughts", branch.ID, branch.FromThought, len(branch.Thoughts))
+			if branch.State != BranchOpen {
+				fmt.Fprintf(&b, ", %s", branch.State)
+				if branch.Reason != "" {
+					fmt.Fprintf(&b, ": %s", branch.Reason)
+				}
+			}
+			if m := branch.MergedInto; m != nil {
+				fmt.Fprintf(&b, ", merged into thought %s", m)
+			}
+			b.WriteString(")")
+		}
+	}
+	b.WriteString(".\n")
+
+	for i := range view.Thoughts {
+		b.WriteString("\n")
+		if i > 0 {
+			b.WriteString("---\n\n")
+		}
+		b.WriteString(markdownRenderer{}.Render(&view.Thoughts[i]))
+	}
+	if view.Compaction != nil {
+		b.WriteString(markdownIssues(view.Compaction.Issues))
+	}
+
+	return b.String(), nil
+}
+
+func jsonExport(view *sessionView) (string, error) {
+	data, err := json.MarshalIndent(sessionResource{
+		SessionID:  view.SessionID,
+		Branches:   view.Branches,
+		Thoughts:   view.Thoughts,
+		Compaction: view.Compaction,
+	}, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to encode session: %v", err)
+	}
+	return string(data) + "\n", nil
+}
+
+// NewExportThoughtsTool creates the tool that exports a recorded session.
+func NewExportThoughtsTool(store *ThoughtStore) fxctx.Tool {
+	return fxctx.NewTool(
+		&mcp.Tool{
+			Name:        "export_thoughts",
+			Description: ptr("Export a session as a Markdown report, a JSON document, or a Mermaid or Graphviz DOT diagram of its revisions and branches. Reports and documents show the current best chain of thoughts unless full is set; diagrams always show every thought and highlight the current best chain unless full is set."),
+			InputSchema: mcp.ToolInputSchema{
+				Type: "object",
+				Properties: map[string]map[string]any{
+					"sessionId": {
+						"type":        "string",
+						"description": "Session to export; defaults to the session that most recently recorded a thought, and is required on servers shared over http or sse",
+					},
+					"format": {
+						"type":        "string",
+						"enum":        exportFormats,
+						"description": "Export format (default markdown)",
+					},
+					"full": {
+						"type":        "boolean",
+						"description": "Export every recorded thought, including superseded ones and abandoned branches, instead of the current best chain; diagrams then leave the chain unhighlighted",
+					},
+				},
+			},
+		},
+		func(args map[string]any) *mcp.CallToolResult {
+			sessionID, err := stringArg(args, "sessionId")
+			if err != nil {
+				return toolErrorResult(err)
+			}
+			sessionID, err = store.SessionOrCurrent(sessionID)
+			if err != nil {
+				return toolErrorResult(err)
+			}
+			format, err := stringArg(args, "format")
+			if err != nil {
+				return toolErrorResult(err)
+			}
+			if format == "" {
+				format = exportFormats[0]
+			}
+			fullArg, err := boolArg(args, "full")
+			if err != nil {
+				return toolErrorResult(err)
+			}
+			full := fullArg != nil && *fullArg
+
+			text, err := exportSession(store, sessionID, format, full)
+			if err != nil {
+				return toolErrorResult(err)
+			}
+			return textResult(text, map[string]any{
+				"sessionId": sessionID,
+				"format":    format,
+				"full":      full,
+			})
+		},
+	)
+}
+
+// runExport implements the export subcommand, which renders a session from
+// the configured storage without starting a server.
+func runExport(args []string, getenv func(string) string, stdout, stderr io.Writer) int {
+	var sessionID, format, output string
+	var full bool
+	cfg, err := loadConfig(args, getenv, func(fs *flag.FlagSet) {
+		fs.SetOutput(stderr)
+		fs.StringVar(&sessionID, "session", defaultSessionID, "session to export")
+		fs.StringVar(&format, "format", exportFormats[0], "export format: "+strings.Join(exportFormats, ", "))
+		fs.StringVar(&output, "output", "", "file to write the export to instead of stdout")
+		fs.BoolVar(&full, "full", false, "export every recorded thought instead of the current best chain")
+	})
+	if errors.Is(err, flag.ErrHelp) {
+		return 0
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 2
+	}
+
+	persister, err := newPersister(cfg.Storage, cfg.StoragePath)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	if persister == nil {
+		fmt.Fprintln(stderr, "nothing to export: thoughts are only kept in memory, set storage to jsonl or bolt")
+		return 2
+	}
+	defer func() { _ = persister.Close() }()
+
+	store := NewThoughtStore()
+	if err := store.Restore(persister); err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+
+	text, err := exportSession(store, sessionID, format, full)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+
+	if output == "" {
+		_, _ = io.WriteString(stdout, text)
+		return 0
+	}
+	// Exports carry the thoughts of a session, so the file is private to the
+	// user; share it deliberately.
+	if err := os.WriteFile(output, []byte(text), 0o600); err != nil {
+		fmt.Fprintf(stderr, "failed to write export: %v\n", err)
+		return 1
+	}
+	return 0
+}
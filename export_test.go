@@ -0,0 +1,268 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newExportStore records a session with a revision and a branch:
+// 1 -> 2 -> 3 (revises 1), and branch alt from 2 with thought 3.
+func newExportStore(t *testing.T, sessionID string) *ThoughtStore {
+	t.Helper()
+
+	return recordSession(t, Options{}, sessionID,
+		map[string]any{"thought": "Frame the problem", "thoughtNumber": 1, "totalThoughts": 3},
+		map[string]any{"thought": "Say \"hello\" <twice>", "thoughtNumber": 2, "totalThoughts": 3},
+		map[string]any{"thought": "Better framing", "thoughtNumber": 3, "totalThoughts": 3, "isRevision": true, "revisesThought": 1},
+		map[string]any{"thought": "Alternative", "thoughtNumber": 3, "totalThoughts": 3, "branchFromThought": 2, "branchId": "alt"},
+	)
+}
+
+func TestExportSession(t *testing.T) {
+	store := newExportStore(t, "review")
+
+	t.Run("markdown", func(t *testing.T) {
+		text, err := exportSession(store, "review", "markdown", true)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		for _, want := range []string{
+			"# Thought session review",
+			"4 thoughts recorded, branches: `alt` from thought 2 (1 thoughts).",
+			"### 💭 Thought 3/3\n\n🔄 Revising thought 1\n\nBetter framing",
+			"🌿 Branching from thought 2 (alt)",
+			"*→ More thinking needed*",
+			"*✓ Thinking complete*",
+		} {
+			if !strings.Contains(text, want) {
+				t.Errorf("Expected markdown to contain %q, got:\n%s", want, text)
+			}
+		}
+	})
+
+	t.Run("json", func(t *testing.T) {
+		text, err := exportSession(store, "review", "json", true)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		var doc sessionResource
+		if err := json.Unmarshal([]byte(text), &doc); err != nil {
+			t.Fatalf("Failed to decode export: %v", err)
+		}
+		if doc.SessionID != "review" || len(doc.Thoughts) != 4 || len(doc.Branches) != 1 {
+			t.Errorf("Expected session review with 4 thoughts and 1 branch, got %+v", doc)
+		}
+		if doc.Thoughts[2].RevisesThought == nil || *doc.Thoughts[2].RevisesThought != 1 {
+			t.Errorf("Expected revision target to be exported, got %+v", doc.Thoughts[2])
+		}
+	})
+
+	t.Run("mermaid", func(t *testing.T) {
+		text, err := exportSession(store, "review", "mermaid", true)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		for _, want := range []string{
+			"graph TD\n",
+			`t1["2/3: Say #quot;hello#quot; #lt;twice#gt;"]`,
+			"t0 --> t1\n",
+			"t1 --> t2\n",
+			"t2 -.->|revises| t0\n",
+			"t1 -->|alt| t3\n",
+			"class t2 revision\n",
+		} {
+			if !strings.Contains(text, want) {
+				t.Errorf("Expected mermaid to contain %q, got:\n%s", want, text)
+			}
+		}
+	})
+
+	t.Run("dot", func(t *testing.T) {
+		text, err := exportSession(store, "review", "dot", true)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if !strings.HasPrefix(text, "digraph \"review\" {\n") || !strings.Contains(text, "t1 -> t3 [label=\"alt\"") {
+			t.Errorf("Expected DOT graph of the session, got:\n%s", text)
+		}
+	})
+
+	t.Run("graphs highlight the compacted chain", func(t *testing.T) {
+		text, err := exportSession(store, "review", "mermaid", false)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		// The chain 1 -> 2 -> 3 (alt) is highlighted among every thought.
+		for _, want := range []string{
+			"t2 -.->|revises| t0\n",
+			"class t0 chain\n",
+			"class t3 chain\n",
+			"linkStyle 0,3 stroke:#1565c0,stroke-width:3px\n",
+		} {
+			if !strings.Contains(text, want) {
+				t.Errorf("Expected mermaid to contain %q, got:\n%s", want, text)
+			}
+		}
+		if strings.Contains(text, "class t2 chain") {
+			t.Errorf("Expected thought 3 of the main line off the chain, got:\n%s", text)
+		}
+
+		text, err = exportSession(store, "review", "dot", false)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		for _, want := range []string{
+			`t2 [label="3/3\nBetter framing", color="darkorange", style="rounded,dashed"];`,
+			`t0 -> t1 [penwidth=2, color="royalblue"];`,
+			`t1 -> t2;`,
+			`t1 -> t3 [label="alt", penwidth=2, color="royalblue"];`,
+		} {
+			if !strings.Contains(text, want) {
+				t.Errorf("Expected DOT to contain %s, got:\n%s", want, text)
+			}
+		}
+
+		if text, _ := exportSession(store, "review", "mermaid", true); strings.Contains(text, "class t0 chain") || strings.Contains(text, "linkStyle") {
+			t.Errorf("Expected no highlighted chain in full exports, got:\n%s", text)
+		}
+	})
+
+	t.Run("compacted by default", func(t *testing.T) {
+		text, err := exportSession(store, "review", "markdown", false)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if !strings.Contains(text, "3 of 4 thoughts in the current best chain, branches: `alt` from thought 2 (1 thoughts).") {
+			t.Errorf("Expected a compaction summary, got:\n%s", text)
+		}
+		if strings.Contains(text, "Better framing") {
+			t.Errorf("Expected the main line beyond the branch to be left out, got:\n%s", text)
+		}
+
+		text, err = exportSession(store, "review", "json", false)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		var doc sessionResource
+		if err := json.Unmarshal([]byte(text), &doc); err != nil {
+			t.Fatalf("Failed to decode export: %v", err)
+		}
+		if len(doc.Thoughts) != 3 || doc.Compaction == nil || doc.Compaction.HistoryLength != 4 {
+			t.Errorf("Expected 3 thoughts compacted from 4, got %+v", doc)
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		if _, err := exportSession(store, "review", "pdf", true); err == nil || !strings.Contains(err.Error(), "unknown format") {
+			t.Errorf("Expected unknown format error, got %v", err)
+		}
+		if _, err := exportSession(store, "missing", "json", true); err == nil || !strings.Contains(err.Error(), "no recorded thoughts") {
+			t.Errorf("Expected error for an empty session, got %v", err)
+		}
+	})
+}
+
+func TestExportThoughtsTool(t *testing.T) {
+	store := newExportStore(t, "review")
+	handler := NewExportThoughtsTool(store).Callback
+
+	result := handler(map[string]any{"format": "mermaid"})
+	if result.IsError != nil && *result.IsError {
+		t.Fatalf("Expected no error, got %s", resultText(result))
+	}
+	if result.Meta["sessionId"] != "review" {
+		t.Errorf("Expected the current session to be exported, got %v", result.Meta["sessionId"])
+	}
+	if !strings.HasPrefix(resultText(result), "graph TD") {
+		t.Errorf("Expected mermaid export, got %s", resultText(result))
+	}
+
+	if result := handler(map[string]any{"sessionId": "review"}); !strings.HasPrefix(resultText(result), "# Thought session review") {
+		t.Errorf("Expected markdown by default, got %s", resultText(result))
+	}
+	if result := handler(map[string]any{"format": "pdf"}); result.IsError == nil || !*result.IsError {
+		t.Error("Expected error for unknown format")
+	}
+
+	for _, args := range []map[string]any{
+		{"sessionId": 42},
+		{"format": true},
+		{"full": "yes"},
+	} {
+		if result := handler(args); result.IsError == nil || !*result.IsError {
+			t.Errorf("Expected error for mistyped arguments %v, got %s", args, resultText(result))
+		}
+	}
+}
+
+func TestRunExport(t *testing.T) {
+	dir := t.TempDir()
+	p, err := NewJSONLPersister(dir)
+	if err != nil {
+		t.Fatalf("Failed to open persister: %v", err)
+	}
+	store := NewThoughtStore()
+	if err := store.Restore(p); err != nil {
+		t.Fatalf("Failed to restore: %v", err)
+	}
+	handler := NewSequentialThinkingTool(store, Options{}).Callback
+	handler(map[string]any{"thought": "persisted", "thoughtNumber": 1, "totalThoughts": 1, "sessionId": "cli"})
+	_ = p.Close()
+
+	env := envFrom(map[string]string{
+		"SEQUENTIAL_THINKING_STORAGE":      "jsonl",
+		"SEQUENTIAL_THINKING_STORAGE_PATH": dir,
+	})
+
+	t.Run("to stdout", func(t *testing.T) {
+		var stdout, stderr bytes.Buffer
+		if code := runExport([]string{"--session", "cli", "--format", "json"}, env, &stdout, &stderr); code != 0 {
+			t.Fatalf("Expected exit code 0, got %d: %s", code, stderr.String())
+		}
+		if !strings.Contains(stdout.String(), `"thought": "persisted"`) {
+			t.Errorf("Expected exported thought, got %s", stdout.String())
+		}
+	})
+
+	t.Run("to file", func(t *testing.T) {
+		output := filepath.Join(t.TempDir(), "cli.md")
+		var stdout, stderr bytes.Buffer
+		if code := runExport([]string{"--session=cli", "--output", output}, env, &stdout, &stderr); code != 0 {
+			t.Fatalf("Expected exit code 0, got %d: %s", code, stderr.String())
+		}
+		data, err := os.ReadFile(output)
+		if err != nil || !strings.HasPrefix(string(data), "# Thought session cli") {
+			t.Errorf("Expected markdown export in file, got %s (%v)", data, err)
+		}
+	})
+
+	t.Run("failures", func(t *testing.T) {
+		testCases := []struct {
+			name    string
+			args    []string
+			env     func(string) string
+			wantErr string
+		}{
+			{name: "memory storage", env: envFrom(nil), wantErr: "only kept in memory"},
+			{name: "unknown session", args: []string{"--session", "nope"}, env: env, wantErr: "no recorded thoughts"},
+			{name: "unknown format", args: []string{"--session", "cli", "--format", "pdf"}, env: env, wantErr: "unknown format"},
+		}
+
+		for _, tc := range testCases {
+			t.Run(tc.name, func(t *testing.T) {
+				var stdout, stderr bytes.Buffer
+				if code := runExport(tc.args, tc.env, &stdout, &stderr); code == 0 {
+					t.Fatal("Expected a non-zero exit code")
+				}
+				if !strings.Contains(stderr.String(), tc.wantErr) {
+					t.Errorf("Expected error containing '%s', got %s", tc.wantErr, stderr.String())
+				}
+			})
+		}
+	})
+}
@@ -0,0 +1,484 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// EdgeKind tells how two thoughts of a ThoughtGraph are related.
+type EdgeKind string
+
+const (
+	// EdgeNext leads to the next thought on the same line of thought.
+	EdgeNext EdgeKind = "next"
+	// EdgeBranch leads from the thought a branch diverges from to the
+	// first thought of the branch.
+	EdgeBranch EdgeKind = "branch"
+	// EdgeRevises leads from a revision to the thought it revises.
+	EdgeRevises EdgeKind = "revises"
+	// EdgeMerge leads from the latest thought of a branch to the thought
+	// that merged it into another line of thought.
+	EdgeMerge EdgeKind = "merge"
+)
+
+// GraphNode is a recorded thought in a ThoughtGraph. Nodes are identified by
+// their position in the session history, since thought numbers repeat across
+// branches.
+type GraphNode struct {
+	ID      int         `json:"id"`
+	Thought ThoughtData `json:"thought"`
+
+	// Revision is set for thoughts that revise an earlier one.
+	Revision bool `json:"revision,omitempty"`
+	// BranchHead is set for the first thought of a branch.
+	BranchHead bool `json:"branchHead,omitempty"`
+	// Merge is set for thoughts that merge a branch.
+	Merge bool `json:"merge,omitempty"`
+	// BranchState is the state the branch of the thought ended up in, empty
+	// on the main line.
+	BranchState BranchState `json:"branchState,omitempty"`
+	// Final is set for the latest thought that needed no further thinking.
+	Final bool `json:"final,omitempty"`
+	// Chain is set for thoughts on the highlighted chain.
+	Chain bool `json:"chain,omitempty"`
+}
+
+// GraphEdge is a directed edge of a ThoughtGraph. Branch edges carry the ID
+// and state of the branch they start, and merge edges the ID of the branch
+// they merge.
+type GraphEdge struct {
+	From        int         `json:"from"`
+	To          int         `json:"to"`
+	Kind        EdgeKind    `json:"kind"`
+	Branch      string      `json:"branch,omitempty"`
+	BranchState BranchState `json:"branchState,omitempty"`
+	// Chain is set for edges that lead along the highlighted chain.
+	Chain bool `json:"chain,omitempty"`
+}
+
+// ThoughtGraph is the reasoning structure of a session as a directed graph,
+// with a node per recorded thought and edges for the order of thoughts, the
+// branches, the merges and the revisions between them.
+type ThoughtGraph struct {
+	Nodes []GraphNode `json:"nodes"`
+	Edges []GraphEdge `json:"edges"`
+
+	// out and in hold the indices of the edges leaving and entering each
+	// node.
+	out [][]int
+	in  [][]int
+}
+
+// NewThoughtGraph builds the graph of a session history. References to
+// thoughts that cannot be found are left out rather than failing, since the
+// store has already checked them when the thoughts were recorded.
+func NewThoughtGraph(history []ThoughtData) *ThoughtGraph {
+	g := &ThoughtGraph{
+		Nodes: make([]GraphNode, len(history)),
+		out:   make([][]int, len(history)),
+		in:    make([][]int, len(history)),
+	}
+
+	states := finalBranchStates(history)
+	final := -1
+	for i, data := range history {
+		g.Nodes[i] = GraphNode{
+			ID:          i,
+			Thought:     data,
+			Revision:    data.RevisesThought != nil,
+			Merge:       data.MergeBranch != "",
+			BranchState: states[data.BranchID],
+		}
+		if isFinal(&data) {
+			final = i
+		}
+
+		if prev := previousOnLine(history, i); prev >= 0 {
+			g.addEdge(GraphEdge{From: prev, To: i, Kind: EdgeNext})
+		} else if data.BranchFromThought != nil {
+			g.Nodes[i].BranchHead = true
+			if origin := findThought(history, i, *data.BranchFromThought, ""); origin >= 0 {
+				g.addEdge(GraphEdge{From: origin, To: i, Kind: EdgeBranch, Branch: data.BranchID, BranchState: states[data.BranchID]})
+			}
+		}
+
+		if data.MergeBranch != "" {
+			if tip := latestOnBranch(history, i, data.MergeBranch); tip >= 0 {
+				g.addEdge(GraphEdge{From: tip, To: i, Kind: EdgeMerge, Branch: data.MergeBranch})
+			}
+		}
+
+		if data.RevisesThought != nil {
+			if target := findThought(history, i, *data.RevisesThought, data.BranchID); target >= 0 {
+				g.addEdge(GraphEdge{From: i, To: target, Kind: EdgeRevises})
+			}
+		}
+	}
+	if final >= 0 {
+		g.Nodes[final].Final = true
+	}
+
+	return g
+}
+
+func (g *ThoughtGraph) addEdge(e GraphEdge) {
+	g.out[e.From] = append(g.out[e.From], len(g.Edges))
+	g.in[e.To] = append(g.in[e.To], len(g.Edges))
+	g.Edges = append(g.Edges, e)
+}
+
+// Highlight marks the nodes of a chain, such as a Lineage, and the edges
+// that lead from one to the next.
+func (g *ThoughtGraph) Highlight(chain []int) {
+	for i, node := range chain {
+		g.Nodes[node].Chain = true
+		if i == 0 {
+			continue
+		}
+		for _, e := range g.in[node] {
+			if g.Edges[e].From == chain[i-1] && g.Edges[e].Kind != EdgeRevises {
+				g.Edges[e].Chain = true
+			}
+		}
+	}
+}
+
+// Successors returns the nodes reached from node by edges of the given
+// kinds, or of any kind if none are given.
+func (g *ThoughtGraph) Successors(node int, kinds ...EdgeKind) []int {
+	var nodes []int
+	for _, e := range g.out[node] {
+		if matchesKind(g.Edges[e].Kind, kinds) {
+			nodes = append(nodes, g.Edges[e].To)
+		}
+	}
+	return nodes
+}
+
+// Predecessors returns the nodes that reach node by edges of the given
+// kinds, or of any kind if none are given.
+func (g *ThoughtGraph) Predecessors(node int, kinds ...EdgeKind) []int {
+	var nodes []int
+	for _, e := range g.in[node] {
+		if matchesKind(g.Edges[e].Kind, kinds) {
+			nodes = append(nodes, g.Edges[e].From)
+		}
+	}
+	return nodes
+}
+
+func matchesKind(kind EdgeKind, kinds []EdgeKind) bool {
+	if len(kinds) == 0 {
+		return true
+	}
+	for _, k := range kinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// RevisedBy returns the revisions of node, in the order they were recorded.
+func (g *ThoughtGraph) RevisedBy(node int) []int {
+	return g.Predecessors(node, EdgeRevises)
+}
+
+// Lineage returns the path of thoughts that led to node, from the first
+// thought of the session down to node itself, following branches back to
+// where they diverged.
+func (g *ThoughtGraph) Lineage(node int) []int {
+	path := []int{node}
+	for {
+		prev := g.Predecessors(node, EdgeNext, EdgeBranch)
+		if len(prev) == 0 {
+			break
+		}
+		node = prev[0]
+		path = append(path, node)
+	}
+
+	for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+		path[i], path[j] = path[j], path[i]
+	}
+	return path
+}
+
+// Final returns the node of the latest thought that needed no further
+// thinking, or -1 if thinking never concluded.
+func (g *ThoughtGraph) Final() int {
+	for i := len(g.Nodes) - 1; i >= 0; i-- {
+		if g.Nodes[i].Final {
+			return i
+		}
+	}
+	return -1
+}
+
+// finalBranchStates returns the state each branch of a history ends up in,
+// replaying the changes of state the way the store records them.
+func finalBranchStates(history []ThoughtData) map[string]BranchState {
+	states := map[string]BranchState{}
+	for _, t := range history {
+		if t.BranchID == "" {
+			continue
+		}
+		if _, ok := states[t.BranchID]; !ok {
+			states[t.BranchID] = BranchOpen
+		}
+		if t.BranchState == BranchChosen {
+			// Choosing a branch reopens the one chosen before it.
+			for id, state := range states {
+				if state == BranchChosen {
+					states[id] = BranchOpen
+				}
+			}
+		}
+		if t.BranchState != "" {
+			states[t.BranchID] = t.BranchState
+		}
+	}
+	return states
+}
+
+// branchLabel names a branch with its state, unless it is still open.
+func branchLabel(id string, state BranchState) string {
+	if state == "" || state == BranchOpen {
+		return id
+	}
+	return fmt.Sprintf("%s (%s)", id, state)
+}
+
+// previousOnLine returns the index of the thought recorded before history[i]
+// on the same branch, or -1 if history[i] starts its line.
+func previousOnLine(history []ThoughtData, i int) int {
+	for j := i - 1; j >= 0; j-- {
+		if history[j].BranchID == history[i].BranchID {
+			return j
+		}
+	}
+	return -1
+}
+
+// latestOnBranch returns the index of the latest thought of a branch that
+// was recorded before index before, or -1 if there is none.
+func latestOnBranch(history []ThoughtData, before int, branchID string) int {
+	for j := before - 1; j >= 0; j-- {
+		if history[j].BranchID == branchID {
+			return j
+		}
+	}
+	return -1
+}
+
+// findThought returns the index of the latest thought numbered number that
+// was recorded before index before, preferring the given branch over the
+// main line and the main line over other branches. It returns -1 if there is
+// none.
+func findThought(history []ThoughtData, before, number int, branchID string) int {
+	fallback := -1
+	for j := before - 1; j >= 0; j-- {
+		t := history[j]
+		if t.ThoughtNumber != number {
+			continue
+		}
+		if t.BranchID == branchID {
+			return j
+		}
+		if fallback < 0 || (t.BranchID == "" && history[fallback].BranchID != "") {
+			fallback = j
+		}
+	}
+	return fallback
+}
+
+const graphLabelLength = 60
+
+// graphLabel shortens a thought to a single line for a node label.
+func graphLabel(text string) string {
+	text = strings.Join(strings.Fields(text), " ")
+	if runes := []rune(text); len(runes) > graphLabelLength {
+		text = string(runes[:graphLabelLength-1]) + "…"
+	}
+	return text
+}
+
+// Mermaid renders the graph as a Mermaid flowchart. Solid edges follow each
+// line of thought, labelled with the branch and its state where one
+// diverges, thick edges lead from merged branches, and dotted edges lead from
+// revisions to what they revise. Thoughts of abandoned branches are greyed
+// out and those of the chosen branch outlined. A highlighted chain is drawn
+// in blue.
+func (g *ThoughtGraph) Mermaid() string {
+	var b strings.Builder
+
+	b.WriteString("graph TD\n")
+	for _, n := range g.Nodes {
+		fmt.Fprintf(&b, "    t%d[\"%d/%d: %s\"]\n", n.ID, n.Thought.ThoughtNumber, n.Thought.TotalThoughts, mermaidLabel(n.Thought.Thought))
+	}
+
+	for _, e := range g.Edges {
+		switch e.Kind {
+		case EdgeNext:
+			fmt.Fprintf(&b, "    t%d --> t%d\n", e.From, e.To)
+		case EdgeBranch:
+			fmt.Fprintf(&b, "    t%d -->|%s| t%d\n", e.From, mermaidLabel(branchLabel(e.Branch, e.BranchState)), e.To)
+		case EdgeRevises:
+			fmt.Fprintf(&b, "    t%d -.->|revises| t%d\n", e.From, e.To)
+		case EdgeMerge:
+			fmt.Fprintf(&b, "    t%d ==>|merge %s| t%d\n", e.From, mermaidLabel(e.Branch), e.To)
+		}
+	}
+
+	b.WriteString("    classDef revision stroke-dasharray: 5 5\n")
+	b.WriteString("    classDef branchHead fill:#e8f5e9\n")
+	b.WriteString("    classDef merge fill:#ede7f6\n")
+	b.WriteString("    classDef abandoned fill:#eeeeee,color:#757575\n")
+	b.WriteString("    classDef chosen stroke:#2e7d32,stroke-width:2px\n")
+	b.WriteString("    classDef final stroke-width:3px\n")
+	b.WriteString("    classDef chain stroke:#1565c0,stroke-width:2px\n")
+	for _, n := range g.Nodes {
+		for _, class := range nodeClasses(n) {
+			fmt.Fprintf(&b, "    class t%d %s\n", n.ID, class)
+		}
+	}
+
+	// Mermaid styles links by the order they were declared in.
+	var chain []string
+	for i, e := range g.Edges {
+		if e.Chain {
+			chain = append(chain, fmt.Sprint(i))
+		}
+	}
+	if len(chain) > 0 {
+		fmt.Fprintf(&b, "    linkStyle %s stroke:#1565c0,stroke-width:3px\n", strings.Join(chain, ","))
+	}
+
+	return b.String()
+}
+
+func nodeClasses(n GraphNode) []string {
+	var classes []string
+	if n.Revision {
+		classes = append(classes, "revision")
+	}
+	if n.BranchHead {
+		classes = append(classes, "branchHead")
+	}
+	if n.Merge {
+		classes = append(classes, "merge")
+	}
+	switch n.BranchState {
+	case BranchAbandoned:
+		classes = append(classes, "abandoned")
+	case BranchChosen:
+		classes = append(classes, "chosen")
+	}
+	if n.Final {
+		classes = append(classes, "final")
+	}
+	if n.Chain {
+		classes = append(classes, "chain")
+	}
+	return classes
+}
+
+// mermaidLabel makes text safe inside a quoted Mermaid label.
+func mermaidLabel(text string) string {
+	return strings.NewReplacer(
+		`"`, "#quot;",
+		"<", "#lt;",
+		">", "#gt;",
+		"|", "#124;",
+	).Replace(graphLabel(text))
+}
+
+// DOT renders the graph in the Graphviz DOT language. Revisions are dashed,
+// branch heads and merges filled, thoughts of abandoned branches greyed out,
+// those of the chosen branch drawn thicker and the final thought drawn with a
+// double border. A highlighted chain is drawn in blue.
+func (g *ThoughtGraph) DOT(name string) string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "digraph %s {\n", dotQuote(name))
+	b.WriteString("    rankdir=TB;\n")
+	b.WriteString("    node [shape=box, style=rounded];\n")
+
+	for _, n := range g.Nodes {
+		attrs := []string{fmt.Sprintf("label=%s", dotQuote(fmt.Sprintf("%d/%d\n%s", n.Thought.ThoughtNumber, n.Thought.TotalThoughts, graphLabel(n.Thought.Thought))))}
+
+		style := []string{"rounded"}
+		if n.Revision {
+			style = append(style, "dashed")
+			attrs = append(attrs, `color="darkorange"`)
+		} else if n.Chain {
+			attrs = append(attrs, `color="royalblue"`)
+		}
+		if n.BranchHead {
+			style = append(style, "filled")
+			attrs = append(attrs, `fillcolor="honeydew"`)
+		} else if n.Merge {
+			style = append(style, "filled")
+			attrs = append(attrs, `fillcolor="lavender"`)
+		}
+		if n.BranchState == BranchAbandoned {
+			attrs = append(attrs, `fontcolor="gray50"`)
+		}
+		if n.BranchState == BranchChosen || n.Chain {
+			attrs = append(attrs, "penwidth=2")
+		}
+		if n.Final {
+			style = append(style, "bold")
+			attrs = append(attrs, "peripheries=2")
+		}
+		if len(style) > 1 {
+			attrs = append(attrs, fmt.Sprintf("style=%s", dotQuote(strings.Join(style, ","))))
+		}
+
+		fmt.Fprintf(&b, "    t%d [%s];\n", n.ID, strings.Join(attrs, ", "))
+	}
+
+	for _, e := range g.Edges {
+		var attrs []string
+		color, penwidth := "", 0
+		switch e.Kind {
+		case EdgeBranch:
+			attrs = append(attrs, fmt.Sprintf("label=%s", dotQuote(branchLabel(e.Branch, e.BranchState))))
+			color = "forestgreen"
+		case EdgeRevises:
+			attrs = append(attrs, `label="revises"`, "style=dashed")
+			color = "darkorange"
+		case EdgeMerge:
+			attrs = append(attrs, fmt.Sprintf("label=%s", dotQuote("merge "+e.Branch)))
+			color, penwidth = "purple", 2
+		}
+		if e.Chain {
+			color, penwidth = "royalblue", 2
+		}
+		if penwidth > 0 {
+			attrs = append(attrs, fmt.Sprintf("penwidth=%d", penwidth))
+		}
+		if color != "" {
+			attrs = append(attrs, fmt.Sprintf("color=%s", dotQuote(color)))
+		}
+		if e.Kind == EdgeRevises {
+			// Revisions point back up the graph, so they must not pull
+			// the ranks of the thoughts around.
+			attrs = append(attrs, "constraint=false")
+		}
+
+		if len(attrs) == 0 {
+			fmt.Fprintf(&b, "    t%d -> t%d;\n", e.From, e.To)
+		} else {
+			fmt.Fprintf(&b, "    t%d -> t%d [%s];\n", e.From, e.To, strings.Join(attrs, ", "))
+		}
+	}
+
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// dotQuote returns s as a quoted DOT string.
+func dotQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s) + `"`
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestThoughtGraph(t *testing.T) {
+	// 0: 1 -> 1: 2 -> 2: 3 (revises 1), and 3: branch alt from 2, continued
+	// by 4, which concludes.
+	history := []ThoughtData{
+		{Thought: "Frame the problem", ThoughtNumber: 1, TotalThoughts: 4, NextThoughtNeeded: ptr(true)},
+		{Thought: "First idea", ThoughtNumber: 2, TotalThoughts: 4, NextThoughtNeeded: ptr(true)},
+		{Thought: "Better framing", ThoughtNumber: 3, TotalThoughts: 4, IsRevision: ptr(true), RevisesThought: ptr(1), NextThoughtNeeded: ptr(true)},
+		{Thought: "Alternative", ThoughtNumber: 3, TotalThoughts: 4, BranchFromThought: ptr(2), BranchID: "alt", NextThoughtNeeded: ptr(true)},
+		{Thought: "Alternative wins", ThoughtNumber: 4, TotalThoughts: 4, BranchID: "alt", NextThoughtNeeded: ptr(false)},
+	}
+	g := NewThoughtGraph(history)
+
+	t.Run("edges", func(t *testing.T) {
+		want := []GraphEdge{
+			{From: 0, To: 1, Kind: EdgeNext},
+			{From: 1, To: 2, Kind: EdgeNext},
+			{From: 2, To: 0, Kind: EdgeRevises},
+			{From: 1, To: 3, Kind: EdgeBranch, Branch: "alt", BranchState: BranchOpen},
+			{From: 3, To: 4, Kind: EdgeNext},
+		}
+		if !slices.Equal(g.Edges, want) {
+			t.Errorf("Expected edges %v, got %v", want, g.Edges)
+		}
+	})
+
+	t.Run("node kinds", func(t *testing.T) {
+		if !g.Nodes[2].Revision || g.Nodes[1].Revision {
+			t.Error("Expected only node 2 to be a revision")
+		}
+		if !g.Nodes[3].BranchHead || g.Nodes[4].BranchHead {
+			t.Error("Expected only node 3 to be a branch head")
+		}
+		if g.Final() != 4 || !g.Nodes[4].Final {
+			t.Errorf("Expected node 4 to be final, got %d", g.Final())
+		}
+	})
+
+	t.Run("queries", func(t *testing.T) {
+		if got := g.Successors(1); !slices.Equal(got, []int{2, 3}) {
+			t.Errorf("Expected successors [2 3], got %v", got)
+		}
+		if got := g.Successors(1, EdgeBranch); !slices.Equal(got, []int{3}) {
+			t.Errorf("Expected branch successors [3], got %v", got)
+		}
+		if got := g.RevisedBy(0); !slices.Equal(got, []int{2}) {
+			t.Errorf("Expected node 0 to be revised by [2], got %v", got)
+		}
+		if got := g.Lineage(4); !slices.Equal(got, []int{0, 1, 3, 4}) {
+			t.Errorf("Expected lineage [0 1 3 4], got %v", got)
+		}
+	})
+
+	t.Run("no conclusion", func(t *testing.T) {
+		if final := NewThoughtGraph(history[:2]).Final(); final != -1 {
+			t.Errorf("Expected no final thought, got %d", final)
+		}
+	})
+
+	t.Run("dot", func(t *testing.T) {
+		dot := g.DOT(`review "q"`)
+		for _, want := range []string{
+			`digraph "review \"q\"" {`,
+			`t0 [label="1/4\nFrame the problem"];`,
+			`t2 [label="3/4\nBetter framing", color="darkorange", style="rounded,dashed"];`,
+			`t3 [label="3/4\nAlternative", fillcolor="honeydew", style="rounded,filled"];`,
+			`t4 [label="4/4\nAlternative wins", peripheries=2, style="rounded,bold"];`,
+			`t1 -> t3 [label="alt", color="forestgreen"];`,
+			`t2 -> t0 [label="revises", style=dashed, color="darkorange", constraint=false];`,
+		} {
+			if !strings.Contains(dot, want) {
+				t.Errorf("Expected DOT to contain %s, got:\n%s", want, dot)
+			}
+		}
+	})
+}
+
+func TestThoughtGraphMerges(t *testing.T) {
+	// 0: 1 -> 1: 2, branch alt from 1 with 2: 2 -> 3: 3, merged by 4: 3 on
+	// the main line.
+	history := []ThoughtData{
+		{Thought: "Frame", ThoughtNumber: 1, TotalThoughts: 3},
+		{Thought: "Main idea", ThoughtNumber: 2, TotalThoughts: 3},
+		{Thought: "Alternative", ThoughtNumber: 2, TotalThoughts: 3, BranchFromThought: ptr(1), BranchID: "alt"},
+		{Thought: "Alternative holds", ThoughtNumber: 3, TotalThoughts: 3, BranchID: "alt"},
+		{Thought: "Combine both", ThoughtNumber: 3, TotalThoughts: 3, MergeBranch: "alt", NextThoughtNeeded: ptr(false)},
+	}
+	g := NewThoughtGraph(history)
+
+	if got := g.Predecessors(4, EdgeMerge); !slices.Equal(got, []int{3}) {
+		t.Errorf("Expected node 4 to merge [3], got %v", got)
+	}
+	if !g.Nodes[4].Merge || g.Nodes[1].Merge {
+		t.Error("Expected only node 4 to be a merge")
+	}
+	// Lineage follows the line the merge was made on.
+	if got := g.Lineage(4); !slices.Equal(got, []int{0, 1, 4}) {
+		t.Errorf("Expected lineage [0 1 4], got %v", got)
+	}
+
+	if mermaid := g.Mermaid(); !strings.Contains(mermaid, "t3 ==>|merge alt| t4\n") || !strings.Contains(mermaid, "class t4 merge\n") {
+		t.Errorf("Expected a merge edge and class, got:\n%s", mermaid)
+	}
+	dot := g.DOT("merge")
+	for _, want := range []string{
+		`t4 [label="3/3\nCombine both", fillcolor="lavender", peripheries=2, style="rounded,filled,bold"];`,
+		`t3 -> t4 [label="merge alt", penwidth=2, color="purple"];`,
+	} {
+		if !strings.Contains(dot, want) {
+			t.Errorf("Expected DOT to contain %s, got:\n%s", want, dot)
+		}
+	}
+}
+
+func TestThoughtGraphBranchStates(t *testing.T) {
+	// Branch a from 1 is chosen over branch b, which is abandoned; choosing
+	// c first and a later leaves c open.
+	history := []ThoughtData{
+		{Thought: "Frame", ThoughtNumber: 1, TotalThoughts: 2},
+		{Thought: "Option C", ThoughtNumber: 2, TotalThoughts: 2, BranchFromThought: ptr(1), BranchID: "c", BranchState: BranchChosen},
+		{Thought: "Option A", ThoughtNumber: 2, TotalThoughts: 2, BranchFromThought: ptr(1), BranchID: "a", BranchState: BranchChosen},
+		{Thought: "Option B", ThoughtNumber: 2, TotalThoughts: 2, BranchFromThought: ptr(1), BranchID: "b", BranchState: BranchAbandoned, BranchReason: "too slow"},
+	}
+	g := NewThoughtGraph(history)
+
+	for i, want := range []BranchState{"", BranchOpen, BranchChosen, BranchAbandoned} {
+		if got := g.Nodes[i].BranchState; got != want {
+			t.Errorf("Node %d: expected branch state %q, got %q", i, want, got)
+		}
+	}
+
+	mermaid := g.Mermaid()
+	for _, want := range []string{"t0 -->|c| t1\n", "t0 -->|a (chosen)| t2\n", "t0 -->|b (abandoned)| t3\n", "class t2 chosen\n", "class t3 abandoned\n"} {
+		if !strings.Contains(mermaid, want) {
+			t.Errorf("Expected Mermaid to contain %q, got:\n%s", want, mermaid)
+		}
+	}
+	dot := g.DOT("states")
+	for _, want := range []string{
+		`t2 [label="2/2\nOption A", fillcolor="honeydew", penwidth=2, style="rounded,filled"];`,
+		`t3 [label="2/2\nOption B", fillcolor="honeydew", fontcolor="gray50", style="rounded,filled"];`,
+		`t0 -> t3 [label="b (abandoned)", color="forestgreen"];`,
+	} {
+		if !strings.Contains(dot, want) {
+			t.Errorf("Expected DOT to contain %s, got:\n%s", want, dot)
+		}
+	}
+}
+
+func TestGraphLabels(t *testing.T) {
+	long := strings.Repeat("a", 100)
+	if got := graphLabel(long); len([]rune(got)) != graphLabelLength {
+		t.Errorf("Expected label of %d runes, got %d", graphLabelLength, len([]rune(got)))
+	}
+	if got := mermaidLabel("two\nlines |pipe|"); got != "two lines #124;pipe#124;" {
+		t.Errorf("Expected single escaped line, got %q", got)
+	}
+	if got := dotQuote("a\\b\n\"c\""); got != `"a\\b\n\"c\""` {
+		t.Errorf("Expected escaped DOT string, got %s", got)
+	}
+}
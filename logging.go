@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"time"
+)
+
+// newLogger creates the structured logger described by cfg. Records never go
+// to stdout, since that is where the stdio transport speaks MCP. The returned
+// function closes the log file, if any.
+func newLogger(cfg *Config) (*slog.Logger, func() error, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(cfg.LogLevel)); err != nil {
+		return nil, nil, fmt.Errorf("invalid log level %q", cfg.LogLevel)
+	}
+
+	var out io.Writer = os.Stderr
+	closeLog := func() error { return nil }
+	if cfg.LogFile != "" {
+		// Records can carry thoughts, so the file is private to the user.
+		f, err := os.OpenFile(cfg.LogFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600) //nolint:gosec // G304: the operator picks the log file
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to open log file: %v", err)
+		}
+		out, closeLog = f, f.Close
+	}
+
+	handlerOpts := &slog.HandlerOptions{Level: level}
+	switch cfg.LogFormat {
+	case "json":
+		return slog.New(slog.NewJSONHandler(out, handlerOpts)), closeLog, nil
+	case "console":
+		return slog.New(slog.NewTextHandler(out, handlerOpts)), closeLog, nil
+	}
+	_ = closeLog()
+	return nil, nil, fmt.Errorf("invalid log format %q, expected json or console", cfg.LogFormat)
+}
+
+func validLogLevel(level string) bool {
+	var l slog.Level
+	return l.UnmarshalText([]byte(level)) == nil
+}
+
+// logThought records an accepted thought.
+func logThought(logger *slog.Logger, sessionID string, data *ThoughtData, state AppendResult, latency time.Duration, withText bool) {
+	if logger == nil {
+		return
+	}
+
+	attrs := []slog.Attr{
+		slog.String("session", sessionID),
+		slog.Int("thought", data.ThoughtNumber),
+		slog.Int("total", data.TotalThoughts),
+		slog.Int("historyLength", state.HistoryLength),
+		slog.Duration("latency", latency),
+	}
+	if data.BranchID != "" {
+		attrs = append(attrs, slog.String("branch", data.BranchID))
+	}
+	if data.BranchFromThought != nil {
+		attrs = append(attrs, slog.Int("branchFrom", *data.BranchFromThought))
+	}
+	if data.RevisesThought != nil {
+		attrs = append(attrs, slog.Int("revises", *data.RevisesThought))
+	}
+	if data.ExtendedBy > 0 {
+		attrs = append(attrs, slog.Int("extendedBy", data.ExtendedBy))
+	}
+	if withText && logger.Enabled(context.Background(), slog.LevelDebug) {
+		attrs = append(attrs, slog.String("text", data.Thought))
+	}
+
+	logger.LogAttrs(context.Background(), slog.LevelInfo, "thought recorded", attrs...)
+}
+
+// logRejected records a thought that was not accepted. args are logged as far
+// as they identify the thought, since they may not have been decoded.
+func logRejected(logger *slog.Logger, sessionID string, args map[string]any, err error, latency time.Duration) {
+	if logger == nil {
+		return
+	}
+
+	attrs := []slog.Attr{
+		slog.String("session", sessionID),
+		slog.String("error", err.Error()),
+		slog.Duration("latency", latency),
+	}
+	for _, field := range [][2]string{
+		{"thoughtNumber", "thought"},
+		{"branchId", "branch"},
+		{"revisesThought", "revises"},
+	} {
+		if v, ok := args[field[0]]; ok {
+			attrs = append(attrs, slog.Any(field[1], v))
+		}
+	}
+
+	logger.LogAttrs(context.Background(), slog.LevelWarn, "thought rejected", attrs...)
+}
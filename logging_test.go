@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func newTestLogger(level slog.Level) (*slog.Logger, *bytes.Buffer) {
+	var buf bytes.Buffer
+	return slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: level})), &buf
+}
+
+func decodeLogRecords(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	t.Helper()
+
+	var records []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var record map[string]any
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("Failed to decode log record %s: %v", line, err)
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+func TestThoughtLogging(t *testing.T) {
+	t.Run("accepted thoughts", func(t *testing.T) {
+		logger, buf := newTestLogger(slog.LevelInfo)
+		handler := NewSequentialThinkingTool(NewThoughtStore(), Options{Logger: logger}).Callback
+
+		handler(map[string]any{"thought": "first", "thoughtNumber": 1, "totalThoughts": 3})
+		handler(map[string]any{"thought": "alt", "thoughtNumber": 2, "totalThoughts": 3, "branchFromThought": 1, "branchId": "b"})
+		handler(map[string]any{"thought": "fix", "thoughtNumber": 3, "totalThoughts": 3, "isRevision": true, "revisesThought": 1})
+
+		records := decodeLogRecords(t, buf)
+		if len(records) != 3 {
+			t.Fatalf("Expected 3 records, got %d", len(records))
+		}
+		for _, record := range records {
+			if record["msg"] != "thought recorded" || record["level"] != "INFO" {
+				t.Errorf("Expected info record of a recorded thought, got %v", record)
+			}
+			if record["session"] != defaultSessionID {
+				t.Errorf("Expected session %s, got %v", defaultSessionID, record["session"])
+			}
+			if _, ok := record["latency"]; !ok {
+				t.Error("Expected latency in record")
+			}
+			if _, ok := record["text"]; ok {
+				t.Error("Expected no thought text at info level")
+			}
+		}
+		if records[1]["branch"] != "b" || records[1]["branchFrom"] != float64(1) {
+			t.Errorf("Expected branch b from thought 1, got %v", records[1])
+		}
+		if records[2]["revises"] != float64(1) || records[2]["thought"] != float64(3) {
+			t.Errorf("Expected thought 3 revising thought 1, got %v", records[2])
+		}
+	})
+
+	t.Run("rejected thoughts", func(t *testing.T) {
+		logger, buf := newTestLogger(slog.LevelInfo)
+		handler := NewSequentialThinkingTool(NewThoughtStore(), Options{Logger: logger}).Callback
+
+		handler(map[string]any{"thought": "orphan", "thoughtNumber": 1, "totalThoughts": 2, "branchId": "missing"})
+
+		records := decodeLogRecords(t, buf)
+		if len(records) != 1 {
+			t.Fatalf("Expected 1 record, got %d", len(records))
+		}
+		if records[0]["msg"] != "thought rejected" || records[0]["level"] != "WARN" {
+			t.Errorf("Expected warning for a rejected thought, got %v", records[0])
+		}
+		if records[0]["branch"] != "missing" || !strings.Contains(records[0]["error"].(string), "does not exist") {
+			t.Errorf("Expected branch and error in record, got %v", records[0])
+		}
+	})
+
+	t.Run("thought text at debug level", func(t *testing.T) {
+		args := map[string]any{"thought": "secret", "thoughtNumber": 1, "totalThoughts": 1}
+
+		logger, buf := newTestLogger(slog.LevelDebug)
+		NewSequentialThinkingTool(NewThoughtStore(), Options{Logger: logger}).Callback(args)
+		if records := decodeLogRecords(t, buf); records[0]["text"] != "secret" {
+			t.Errorf("Expected thought text at debug level, got %v", records[0])
+		}
+
+		logger, buf = newTestLogger(slog.LevelDebug)
+		NewSequentialThinkingTool(NewThoughtStore(), Options{Logger: logger, DisableThoughtLogging: true}).Callback(args)
+		if records := decodeLogRecords(t, buf); records[0]["text"] != nil {
+			t.Errorf("Expected no thought text with thought logging disabled, got %v", records[0])
+		}
+	})
+}
+
+func TestNewLogger(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "server.log")
+	cfg := defaultConfig()
+	cfg.LogFormat, cfg.LogLevel, cfg.LogFile = "json", "warn", path
+
+	logger, closeLog, err := newLogger(cfg)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	logger.Info("dropped")
+	logger.Warn("kept")
+	if err := closeLog(); err != nil {
+		t.Fatalf("Failed to close log: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read log file: %v", err)
+	}
+	if strings.Contains(string(data), "dropped") || !strings.Contains(string(data), `"msg":"kept"`) {
+		t.Errorf("Expected only the warning as JSON, got %s", data)
+	}
+}
@@ -2,16 +2,20 @@
 package main
 
 import (
+	"errors"
+	"flag"
 	"fmt"
+	"log/slog"
 	"os"
+	"slices"
 	"strings"
+	"time"
 
-	"github.com/go-playground/validator/v10"
-	"github.com/go-viper/mapstructure/v2"
 	"github.com/strowk/foxy-contexts/pkg/app"
 	"github.com/strowk/foxy-contexts/pkg/fxctx"
 	"github.com/strowk/foxy-contexts/pkg/mcp"
-	"github.com/strowk/foxy-contexts/pkg/stdio"
+	"go.uber.org/fx"
+	"go.uber.org/fx/fxevent"
 )
 
 func ptr[T any](v T) *T {
@@ -29,26 +33,126 @@ type ThoughtData struct {
 	BranchID          string `json:"branchId,omitempty" mapstructure:"branchId"`
 	NeedsMoreThoughts *bool  `json:"needsMoreThoughts,omitempty" mapstructure:"needsMoreThoughts"`
 	NextThoughtNeeded *bool  `json:"nextThoughtNeeded,omitempty" mapstructure:"nextThoughtNeeded"`
+	// MergeBranch names a branch whose conclusion the thought folds into
+	// its own line of thought: the main line, or the branch BranchID.
+	MergeBranch string `json:"mergeBranch,omitempty" mapstructure:"mergeBranch"`
+	// BranchState moves the branch BranchID to a new state once the thought
+	// is recorded, giving BranchReason as the reason.
+	BranchState  BranchState `json:"branchState,omitempty" mapstructure:"branchState"`
+	BranchReason string      `json:"branchReason,omitempty" mapstructure:"branchReason"`
+
+	// SessionID names the session the thought belongs to. It is not stored
+	// with the thought, since the store keeps thoughts per session.
+	SessionID string `json:"-" mapstructure:"sessionId"`
+	// Format names the renderer of the response, overriding the server
+	// default for this call.
+	Format string `json:"-" mapstructure:"format"`
+
+	// ExtendedBy is the number of thoughts the server added to TotalThoughts.
+	ExtendedBy int `json:"extendedBy,omitempty" mapstructure:"-"`
+}
+
+// Options controls how the sequential thinking tool treats its input.
+type Options struct {
+	// ExtendTotal raises totalThoughts to thoughtNumber instead of rejecting
+	// thoughts beyond the current estimate.
+	ExtendTotal bool
+
+	// DisableThoughtLogging replaces the formatted thought in responses
+	// with a short notice, and keeps it out of the log.
+	DisableThoughtLogging bool
+
+	// Strict rejects unknown arguments and values that are not of the type
+	// the input schema declares. Otherwise unknown arguments are ignored and
+	// numbers and booleans sent as strings are parsed.
+	Strict bool
+
+	// Format names the renderer of responses that do not ask for one,
+	// empty for the default.
+	Format string
+
+	// Logger receives a record for every thought, nil disables logging.
+	Logger *slog.Logger
 }
 
-func validateThoughtData(args map[string]any) (*ThoughtData, error) {
-	var data ThoughtData
+func validateThoughtData(args map[string]any, opts Options) (*ThoughtData, error) {
+	decode := decodeThoughtData
+	if opts.Strict {
+		decode = decodeThoughtDataStrict
+	}
+	data, err := decode(args)
+	if err != nil {
+		return nil, err
+	}
+
+	if data.Format != "" {
+		if _, err := rendererFor(data.Format); err != nil {
+			return nil, fieldError(FieldError{
+				Field:   "format",
+				Rule:    "enum",
+				Message: err.Error(),
+				Value:   data.Format,
+			})
+		}
+	}
+
+	if err := checkBranchState(&data); err != nil {
+		return nil, err
+	}
+
+	needsMore := data.NeedsMoreThoughts != nil && *data.NeedsMoreThoughts
 
-	if err := mapstructure.Decode(args, &data); err != nil {
-		return nil, fmt.Errorf("failed to decode input: %v", err)
+	// Thoughts beyond the estimate are fine once the caller has said it
+	// needs more of them, or when the server is set up to extend.
+	if data.ThoughtNumber > data.TotalThoughts && !opts.ExtendTotal && !needsMore {
+		return nil, fieldError(FieldError{
+			Field:   "thoughtNumber",
+			Rule:    "total",
+			Message: "thoughtNumber cannot be greater than totalThoughts",
+			Value:   data.ThoughtNumber,
+			Hint:    fmt.Sprintf("raise totalThoughts to at least %d, or set needsMoreThoughts", data.ThoughtNumber),
+		})
 	}
 
-	validate := validator.New()
-	if err := validate.Struct(&data); err != nil {
-		return nil, fmt.Errorf("validation failed: %v", err)
+	total := max(data.TotalThoughts, data.ThoughtNumber)
+	if needsMore {
+		// Make room for at least one more thought after this one.
+		total++
 	}
+	data.ExtendedBy = total - data.TotalThoughts
+	data.TotalThoughts = total
 
-	if data.ThoughtNumber > data.TotalThoughts {
-		return nil, fmt.Errorf("thoughtNumber cannot be greater than totalThoughts")
+	isRevision := data.IsRevision != nil && *data.IsRevision
+	if data.RevisesThought != nil && !isRevision {
+		return nil, fieldError(FieldError{
+			Field:   "isRevision",
+			Rule:    "required",
+			Message: "revisesThought requires isRevision to be true",
+			Hint:    "set isRevision to true, or leave out revisesThought",
+		})
+	}
+	if isRevision && data.RevisesThought == nil {
+		return nil, fieldError(FieldError{
+			Field:   "revisesThought",
+			Rule:    "required",
+			Message: "isRevision requires revisesThought",
+			Hint:    "set revisesThought to the number of the thought being revised",
+		})
+	}
+	if data.RevisesThought != nil && *data.RevisesThought >= data.ThoughtNumber {
+		return nil, fieldError(FieldError{
+			Field:   "revisesThought",
+			Rule:    "earlier",
+			Message: fmt.Sprintf("thought %d cannot revise thought %d, only earlier thoughts can be revised", data.ThoughtNumber, *data.RevisesThought),
+			Value:   *data.RevisesThought,
+		})
 	}
 
-	// Automatic calculation of NextThoughtNeeded if not explicitly provided
-	if data.NextThoughtNeeded == nil {
+	// needsMoreThoughts wins over an explicit nextThoughtNeeded, otherwise
+	// NextThoughtNeeded is calculated automatically if not explicitly provided
+	if needsMore {
+		data.NextThoughtNeeded = ptr(true)
+	} else if data.NextThoughtNeeded == nil {
 		autoCalculated := data.ThoughtNumber < data.TotalThoughts
 		data.NextThoughtNeeded = &autoCalculated
 	}
@@ -57,44 +161,221 @@ func validateThoughtData(args map[string]any) (*ThoughtData, error) {
 }
 
 func formatThought(data *ThoughtData) string {
-	if os.Getenv("DISABLE_THOUGHT_LOGGING") == "true" {
-		return "Thought logging is disabled."
-	}
-
 	var b strings.Builder
 
 	fmt.Fprintf(&b, "💭 Thought %d/%d\n", data.ThoughtNumber, data.TotalThoughts)
 
+	for _, marker := range thoughtMarkers(data) {
+		fmt.Fprintf(&b, "%s %s\n", marker.emoji, marker.text)
+	}
+
+	fmt.Fprintf(&b, "\n%s\n", data.Thought)
+
+	status, nextNeeded := thoughtStatus(data)
+	fmt.Fprintf(&b, "\n%s\n", status.emoji+" "+status.text)
+
+	fmt.Fprintf(&b, "\nStatus: Thought %d/%d | Next needed: %v\n", data.ThoughtNumber, data.TotalThoughts, nextNeeded)
+
+	return b.String()
+}
+
+// checkBranchState makes sure a change of branch state names a known state,
+// the branch it applies to and, for abandoned branches, a reason.
+func checkBranchState(data *ThoughtData) error {
+	switch {
+	case data.BranchState == "" && data.BranchReason != "":
+		return fieldError(FieldError{
+			Field:   "branchState",
+			Rule:    "required",
+			Message: "branchReason requires branchState",
+			Hint:    "set branchState to the state the reason explains, or leave out branchReason",
+		})
+	case data.BranchState == "":
+		return nil
+	case !slices.Contains(branchStates, string(data.BranchState)):
+		return fieldError(FieldError{
+			Field:   "branchState",
+			Rule:    "enum",
+			Message: fmt.Sprintf("unknown branchState %q, expected one of %s", data.BranchState, strings.Join(branchStates, ", ")),
+			Value:   data.BranchState,
+		})
+	case data.BranchID == "":
+		return fieldError(FieldError{
+			Field:   "branchId",
+			Rule:    "required",
+			Message: "branchState requires branchId",
+			Hint:    "set branchId to the branch whose state changes",
+		})
+	case data.BranchState == BranchAbandoned && data.BranchReason == "":
+		return fieldError(FieldError{
+			Field:   "branchReason",
+			Rule:    "required",
+			Message: "abandoning a branch requires branchReason",
+			Hint:    "say why the branch is given up",
+		})
+	}
+	return nil
+}
+
+// thoughtMarker is a line of a rendered thought, with the emoji that the
+// default style puts in front of it.
+type thoughtMarker struct {
+	emoji string
+	text  string
+}
+
+// thoughtMarkers returns the lines that flag extensions, revisions and
+// branches of a thought.
+func thoughtMarkers(data *ThoughtData) []thoughtMarker {
+	var markers []thoughtMarker
+
+	if data.NeedsMoreThoughts != nil && *data.NeedsMoreThoughts {
+		markers = append(markers, thoughtMarker{"🔁", fmt.Sprintf("Extending plan to %d thoughts (+%d)", data.TotalThoughts, data.ExtendedBy)})
+	} else if data.ExtendedBy > 0 {
+		markers = append(markers, thoughtMarker{"📈", fmt.Sprintf("Estimate raised to %d thoughts (+%d)", data.TotalThoughts, data.ExtendedBy)})
+	}
+
 	if data.IsRevision != nil && *data.IsRevision && data.RevisesThought != nil {
-		fmt.Fprintf(&b, "🔄 Revising thought %d\n", *data.RevisesThought)
+		markers = append(markers, thoughtMarker{"🔄", fmt.Sprintf("Revising thought %d", *data.RevisesThought)})
 	}
 
 	if data.BranchFromThought != nil {
-		fmt.Fprintf(&b, "🌿 Branching from thought %d", *data.BranchFromThought)
+		text := fmt.Sprintf("Branching from thought %d", *data.BranchFromThought)
 		if data.BranchID != "" {
-			fmt.Fprintf(&b, " (%s)", data.BranchID)
+			text += fmt.Sprintf(" (%s)", data.BranchID)
 		}
-		b.WriteString("\n")
+		markers = append(markers, thoughtMarker{"🌿", text})
 	}
 
-	fmt.Fprintf(&b, "\n%s\n", data.Thought)
+	if data.MergeBranch != "" {
+		markers = append(markers, thoughtMarker{"🔀", fmt.Sprintf("Merging branch %s", data.MergeBranch)})
+	}
+
+	if marker, ok := branchStateMarker(data); ok {
+		markers = append(markers, marker)
+	}
 
-	status := "✓ Thinking complete"
-	nextNeeded := false
+	return markers
+}
+
+func branchStateMarker(data *ThoughtData) (thoughtMarker, bool) {
+	var marker thoughtMarker
+	switch data.BranchState {
+	case BranchOpen:
+		marker = thoughtMarker{"🔓", fmt.Sprintf("Reopening branch %s", data.BranchID)}
+	case BranchAbandoned:
+		marker = thoughtMarker{"⛔", fmt.Sprintf("Abandoning branch %s", data.BranchID)}
+	case BranchChosen:
+		marker = thoughtMarker{"🏆", fmt.Sprintf("Choosing branch %s", data.BranchID)}
+	default:
+		return marker, false
+	}
+	if data.BranchReason != "" {
+		marker.text += ": " + data.BranchReason
+	}
+	return marker, true
+}
+
+func thoughtStatus(data *ThoughtData) (thoughtMarker, bool) {
 	if data.NextThoughtNeeded != nil && *data.NextThoughtNeeded {
-		status = "→ More thinking needed"
-		nextNeeded = true
+		return thoughtMarker{"→", "More thinking needed"}, true
 	}
-	fmt.Fprintf(&b, "\n%s\n", status)
+	return thoughtMarker{"✓", "Thinking complete"}, false
+}
 
-	fmt.Fprintf(&b, "\nStatus: Thought %d/%d | Next needed: %v\n", data.ThoughtNumber, data.TotalThoughts, nextNeeded)
+// validationErrorResult reports a rejected thought. The rejected arguments
+// are listed in the meta, under errors, and in the structured content.
+func validationErrorResult(err error) (*mcp.CallToolResult, any) {
+	failure := &ValidationFailure{Error: err.Error(), Errors: fieldErrors(err)}
+	return &mcp.CallToolResult{
+		IsError: ptr(true),
+		Content: []any{
+			mcp.TextContent{
+				Type: "text",
+				Text: fmt.Sprintf("Validation error: %v", err),
+			},
+		},
+		Meta: map[string]any{
+			"error":  failure.Error,
+			"errors": failure.Errors,
+		},
+	}, failure
+}
 
-	return b.String()
+// ThoughtResult is the structured content of a sequential_thinking result.
+type ThoughtResult struct {
+	SessionID            string         `json:"sessionId"`
+	Thought              string         `json:"thought,omitempty"`
+	ThoughtNumber        int            `json:"thoughtNumber"`
+	TotalThoughts        int            `json:"totalThoughts"`
+	ExtendedBy           int            `json:"extendedBy"`
+	NextThoughtNeeded    bool           `json:"nextThoughtNeeded"`
+	RevisesThought       *int           `json:"revisesThought,omitempty"`
+	BranchFromThought    *int           `json:"branchFromThought,omitempty"`
+	BranchID             string         `json:"branchId,omitempty"`
+	MergeBranch          string         `json:"mergeBranch,omitempty"`
+	BranchState          BranchState    `json:"branchState,omitempty"`
+	Branches             []BranchStatus `json:"branches"`
+	ThoughtHistoryLength int            `json:"thoughtHistoryLength"`
+}
+
+// thoughtResultSchema is the output schema of sequential_thinking, describing
+// ThoughtResult, or ValidationFailure for rejected thoughts.
+var thoughtResultSchema = map[string]any{
+	"type": "object",
+	"properties": map[string]any{
+		"sessionId":         map[string]any{"type": "string", "description": "Session the thought was recorded in"},
+		"thought":           map[string]any{"type": "string", "description": "The recorded thought, left out when thought logging is disabled"},
+		"thoughtNumber":     map[string]any{"type": "integer", "minimum": 1},
+		"totalThoughts":     map[string]any{"type": "integer", "minimum": 1, "description": "Effective estimate after any extension"},
+		"extendedBy":        map[string]any{"type": "integer", "minimum": 0, "description": "Number of thoughts the server added to totalThoughts"},
+		"nextThoughtNeeded": map[string]any{"type": "boolean"},
+		"revisesThought":    map[string]any{"type": "integer", "minimum": 1, "description": "Thought revised by this one"},
+		"branchFromThought": map[string]any{"type": "integer", "minimum": 1},
+		"branchId":          map[string]any{"type": "string"},
+		"mergeBranch":       map[string]any{"type": "string", "description": "Branch merged into the line of this thought"},
+		"branchState":       map[string]any{"type": "string", "enum": branchStates, "description": "State the branch of this thought moved to"},
+		"branches": map[string]any{
+			"type":        "array",
+			"description": "Branches of the session in creation order",
+			"items": map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"id":     map[string]any{"type": "string"},
+					"state":  map[string]any{"type": "string", "enum": branchStates},
+					"reason": map[string]any{"type": "string", "description": "Why the branch reached its state, if given"},
+				},
+				"required": []string{"id", "state"},
+			},
+		},
+		"thoughtHistoryLength": map[string]any{"type": "integer", "minimum": 1},
+		"error":                map[string]any{"type": "string", "description": "Why the thought was rejected"},
+		"errors": map[string]any{
+			"type":        "array",
+			"description": "The rejected arguments",
+			"items": map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"field":   map[string]any{"type": "string"},
+					"rule":    map[string]any{"type": "string", "description": "The check that failed, such as unknown, type, required, min or exists"},
+					"message": map[string]any{"type": "string"},
+					"value":   map[string]any{"description": "The value given for the argument"},
+					"hint":    map[string]any{"type": "string", "description": "How to correct the argument"},
+				},
+				"required": []string{"field", "rule", "message"},
+			},
+		},
+	},
+	"anyOf": []any{
+		map[string]any{"required": []string{"sessionId", "thoughtNumber", "totalThoughts", "extendedBy", "nextThoughtNeeded", "branches", "thoughtHistoryLength"}},
+		map[string]any{"required": []string{"error", "errors"}},
+	},
 }
 
-// NewSequentialThinkingTool creates and returns a new sequential thinking MCP tool.
-func NewSequentialThinkingTool() fxctx.Tool {
-	return fxctx.NewTool(
+// NewSequentialThinkingTool creates and returns a new sequential thinking MCP tool
+// that records accepted thoughts in store.
+func NewSequentialThinkingTool(store *ThoughtStore, opts Options) structuredTool {
+	return newStructuredTool(
 		&mcp.Tool{
 			Name:        "sequential_thinking",
 			Description: ptr("A detailed tool for dynamic and reflective problem-solving through thoughts. This tool helps analyze problems through a flexible thinking process that can adapt and evolve. Each thought can build on, question, or revise previous insights as understanding deepens."),
@@ -137,55 +418,209 @@ func NewSequentialThinkingTool() fxctx.Tool {
 						"type":        "string",
 						"description": "Identifier for the current branch (if any)",
 					},
+					"mergeBranch": {
+						"type":        "string",
+						"description": "If folding the conclusion of a branch back into this line of thought (the main line, or branchId), which branch is merged",
+					},
+					"branchState": {
+						"type":        "string",
+						"enum":        branchStates,
+						"description": "Moves the branch of this thought (branchId) to a new state: abandoned to give it up, which stops further thoughts on it until it is reopened, open to reopen it, or chosen to select it as the winner",
+					},
+					"branchReason": {
+						"type":        "string",
+						"description": "Why the branch changes state; required when abandoning it",
+					},
 					"needsMoreThoughts": {
 						"type":        "boolean",
-						"description": "If reaching end but realizing more thoughts needed",
+						"description": "If reaching end but realizing more thoughts needed (keeps the chain going and raises totalThoughts)",
+					},
+					"sessionId": {
+						"type":        "string",
+						"description": "Session the thought belongs to, as returned by start_session; thoughts without one go to the default session, except on servers shared over http or sse, where thought 1 starts a new session whose sessionId is returned and later thoughts must pass it",
+					},
+					"format": {
+						"type":        "string",
+						"enum":        renderFormats,
+						"description": "How to render the response: emoji (default), plain ASCII, compact single line, markdown or json",
 					},
 				},
 				Required: []string{"thought", "thoughtNumber", "totalThoughts"},
 			},
 		},
-		func(args map[string]any) *mcp.CallToolResult {
-			data, err := validateThoughtData(args)
+		thoughtResultSchema,
+		func(args map[string]any) (*mcp.CallToolResult, any) {
+			start := time.Now()
+
+			data, err := validateThoughtData(args, opts)
 			if err != nil {
-				return &mcp.CallToolResult{
-					IsError: ptr(true),
-					Content: []any{
-						mcp.TextContent{
-							Type: "text",
-							Text: fmt.Sprintf("Validation error: %v", err),
-						},
-					},
+				logRejected(opts.Logger, requestedSession(args), args, err, time.Since(start))
+				return validationErrorResult(err)
+			}
+
+			sessionID := data.SessionID
+			if sessionID == "" {
+				if sessionID, err = store.SessionForThought(data.ThoughtNumber); err != nil {
+					logRejected(opts.Logger, requestedSession(args), args, err, time.Since(start))
+					return validationErrorResult(err)
+				}
+			}
+
+			state, err := store.Append(sessionID, *data)
+			if err != nil {
+				logRejected(opts.Logger, sessionID, args, err, time.Since(start))
+				return validationErrorResult(err)
+			}
+
+			text := "Thought logging is disabled."
+			if !opts.DisableThoughtLogging {
+				format := data.Format
+				if format == "" {
+					format = opts.Format
+				}
+				renderer, err := rendererFor(format)
+				if err != nil {
+					return validationErrorResult(err)
 				}
+				text = renderer.Render(data)
 			}
 
-			return &mcp.CallToolResult{
+			result := &mcp.CallToolResult{
 				Content: []any{
 					mcp.TextContent{
 						Type: "text",
-						Text: formatThought(data),
+						Text: text,
 					},
 				},
 				IsError: ptr(false),
 				Meta: map[string]any{
+					"sessionId":            sessionID,
 					"thoughtNumber":        data.ThoughtNumber,
 					"totalThoughts":        data.TotalThoughts,
 					"nextThoughtNeeded":    data.NextThoughtNeeded != nil && *data.NextThoughtNeeded,
-					"branches":             []any{},
-					"thoughtHistoryLength": 1,
+					"branches":             state.Branches,
+					"thoughtHistoryLength": state.HistoryLength,
+					"extended":             data.ExtendedBy > 0,
+					"extendedBy":           data.ExtendedBy,
 				},
 			}
+
+			structured := &ThoughtResult{
+				SessionID:            sessionID,
+				ThoughtNumber:        data.ThoughtNumber,
+				TotalThoughts:        data.TotalThoughts,
+				ExtendedBy:           data.ExtendedBy,
+				NextThoughtNeeded:    data.NextThoughtNeeded != nil && *data.NextThoughtNeeded,
+				RevisesThought:       data.RevisesThought,
+				BranchFromThought:    data.BranchFromThought,
+				BranchID:             data.BranchID,
+				MergeBranch:          data.MergeBranch,
+				BranchState:          data.BranchState,
+				Branches:             state.Branches,
+				ThoughtHistoryLength: state.HistoryLength,
+			}
+			if !opts.DisableThoughtLogging {
+				structured.Thought = data.Thought
+			}
+
+			logThought(opts.Logger, sessionID, data, state, time.Since(start), !opts.DisableThoughtLogging)
+			return result, structured
 		},
 	)
 }
 
 func main() {
-	if err := app.NewBuilder().
-		WithName("sequential_thinking").
-		WithVersion("1.0.0").
-		WithTool(NewSequentialThinkingTool).
-		WithTransport(stdio.NewTransport()).
+	os.Exit(run())
+}
+
+// run starts the server and returns the exit code once it stops, so that
+// deferred cleanup happens before the process exits.
+func run() int {
+	if len(os.Args) > 1 && os.Args[1] == "export" {
+		return runExport(os.Args[2:], os.Getenv, os.Stdout, os.Stderr)
+	}
+
+	cfg, err := loadConfig(os.Args[1:], os.Getenv)
+	if errors.Is(err, flag.ErrHelp) {
+		return 0
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	logger, closeLog, err := newLogger(cfg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	defer func() { _ = closeLog() }()
+	slog.SetDefault(logger)
+
+	transport, err := newTransport(cfg.Transport, cfg.Listen, cfg.AllowedOrigins)
+	if err != nil {
+		logger.Error("invalid transport", "error", err)
+		return 2
+	}
+
+	store := NewThoughtStore()
+	store.SetHistoryLimit(cfg.MaxHistory)
+	store.SetShared(cfg.Transport != "stdio")
+
+	persister, err := newPersister(cfg.Storage, cfg.StoragePath)
+	if err != nil {
+		logger.Error("failed to open storage", "storage", cfg.Storage, "error", err)
+		return 1
+	}
+	if persister != nil {
+		defer func() {
+			if err := persister.Close(); err != nil {
+				logger.Error("failed to close storage", "error", err)
+			}
+		}()
+		if err := store.Restore(persister); err != nil {
+			logger.Error("failed to restore sessions", "storage", cfg.Storage, "error", err)
+			return 1
+		}
+		logger.Info("sessions restored", "storage", cfg.Storage, "path", cfg.StoragePath, "sessions", len(store.Sessions()))
+	}
+
+	opts := cfg.Options()
+	opts.Logger = logger
+
+	fxLogger := &fxevent.SlogLogger{Logger: logger}
+	fxLogger.UseLogLevel(slog.LevelDebug)
+
+	tools := []fxctx.Tool{
+		NewSequentialThinkingTool(store, opts),
+		NewStartSessionTool(store, opts),
+		NewListSessionsTool(store),
+		NewEndSessionTool(store, opts),
+		NewExportThoughtsTool(store),
+		NewGetThoughtsTool(store, opts),
+		NewCompactSessionTool(store, opts),
+	}
+
+	builder := app.NewBuilder().
+		WithName(cfg.Name).
+		WithVersion(version).
+		WithServerCapabilities(&mcp.ServerCapabilities{
+			Tools:     &mcp.ServerCapabilitiesTools{},
+			Resources: &mcp.ServerCapabilitiesResources{},
+			Prompts:   &mcp.ServerCapabilitiesPrompts{},
+		}).
+		WithResourceProvider(func() fxctx.ResourceProvider { return NewThoughtResourceProvider(store) }).
+		WithFxOptions(fx.WithLogger(func() fxevent.Logger { return fxLogger }))
+
+	for _, prompt := range NewThinkingPrompts() {
+		builder.WithPrompt(func() fxctx.Prompt { return prompt })
+	}
+
+	if err := builder.
+		WithTransport(withToolHandlers(transport, tools)).
 		Run(); err != nil {
-		os.Exit(1)
+		logger.Error("server stopped", "error", err)
+		return 1
 	}
+	return 0
 }
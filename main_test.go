@@ -2,7 +2,6 @@ package main
 
 import (
 	"fmt"
-	"os"
 	"reflect"
 	"strings"
 	"testing"
@@ -47,7 +46,7 @@ func TestValidateThoughtData(t *testing.T) {
 			"nextThoughtNeeded": true,
 		}
 
-		data, err := validateThoughtData(args)
+		data, err := validateThoughtData(args, Options{})
 		if err != nil {
 			t.Fatalf("Expected no error, got %v", err)
 		}
@@ -74,7 +73,7 @@ func TestValidateThoughtData(t *testing.T) {
 			"nextThoughtNeeded": false,
 		}
 
-		data, err := validateThoughtData(args)
+		data, err := validateThoughtData(args, Options{})
 		if err != nil {
 			t.Fatalf("Expected no error, got %v", err)
 		}
@@ -97,7 +96,7 @@ func TestValidateThoughtData(t *testing.T) {
 			"needsMoreThoughts": false,
 		}
 
-		data, err := validateThoughtData(args)
+		data, err := validateThoughtData(args, Options{})
 		if err != nil {
 			t.Fatalf("Expected no error, got %v", err)
 		}
@@ -126,7 +125,7 @@ func TestValidateThoughtData(t *testing.T) {
 			"nextThoughtNeeded": true,
 		}
 
-		_, err := validateThoughtData(args)
+		_, err := validateThoughtData(args, Options{})
 		if err == nil {
 			t.Fatal("Expected error for missing thought field")
 		}
@@ -142,7 +141,7 @@ func TestValidateThoughtData(t *testing.T) {
 			"nextThoughtNeeded": true,
 		}
 
-		_, err := validateThoughtData(args)
+		_, err := validateThoughtData(args, Options{})
 		if err == nil {
 			t.Fatal("Expected error for missing thoughtNumber field")
 		}
@@ -155,7 +154,7 @@ func TestValidateThoughtData(t *testing.T) {
 			"nextThoughtNeeded": true,
 		}
 
-		_, err := validateThoughtData(args)
+		_, err := validateThoughtData(args, Options{})
 		if err == nil {
 			t.Fatal("Expected error for missing totalThoughts field")
 		}
@@ -169,7 +168,7 @@ func TestValidateThoughtData(t *testing.T) {
 			"nextThoughtNeeded": true,
 		}
 
-		_, err := validateThoughtData(args)
+		_, err := validateThoughtData(args, Options{})
 		if err == nil {
 			t.Fatal("Expected error for thoughtNumber = 0")
 		}
@@ -183,7 +182,7 @@ func TestValidateThoughtData(t *testing.T) {
 			"nextThoughtNeeded": true,
 		}
 
-		_, err := validateThoughtData(args)
+		_, err := validateThoughtData(args, Options{})
 		if err == nil {
 			t.Fatal("Expected error for negative thoughtNumber")
 		}
@@ -197,7 +196,7 @@ func TestValidateThoughtData(t *testing.T) {
 			"nextThoughtNeeded": true,
 		}
 
-		_, err := validateThoughtData(args)
+		_, err := validateThoughtData(args, Options{})
 		if err == nil {
 			t.Fatal("Expected error for totalThoughts = 0")
 		}
@@ -211,7 +210,7 @@ func TestValidateThoughtData(t *testing.T) {
 			"nextThoughtNeeded": true,
 		}
 
-		_, err := validateThoughtData(args)
+		_, err := validateThoughtData(args, Options{})
 		if err == nil {
 			t.Fatal("Expected error for thoughtNumber > totalThoughts")
 		}
@@ -220,6 +219,122 @@ func TestValidateThoughtData(t *testing.T) {
 		}
 	})
 
+	t.Run("thoughtNumber greater than totalThoughts extends the estimate", func(t *testing.T) {
+		args := map[string]any{
+			"thought":       "Test thought",
+			"thoughtNumber": 5,
+			"totalThoughts": 3,
+			"extendedBy":    10,
+		}
+
+		data, err := validateThoughtData(args, Options{ExtendTotal: true})
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if data.TotalThoughts != 5 {
+			t.Errorf("Expected totalThoughts = 5, got %d", data.TotalThoughts)
+		}
+		if data.ExtendedBy != 2 {
+			t.Errorf("Expected extendedBy = 2, got %d", data.ExtendedBy)
+		}
+		if data.NextThoughtNeeded == nil || *data.NextThoughtNeeded {
+			t.Errorf("Expected automatic nextThoughtNeeded = false, got %v", data.NextThoughtNeeded)
+		}
+	})
+
+	t.Run("needsMoreThoughts allows going beyond totalThoughts", func(t *testing.T) {
+		args := map[string]any{
+			"thought":           "Test thought",
+			"thoughtNumber":     4,
+			"totalThoughts":     3,
+			"needsMoreThoughts": true,
+		}
+
+		data, err := validateThoughtData(args, Options{})
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if data.TotalThoughts < 4 {
+			t.Errorf("Expected totalThoughts >= 4, got %d", data.TotalThoughts)
+		}
+	})
+
+	t.Run("needsMoreThoughts forces another thought", func(t *testing.T) {
+		args := map[string]any{
+			"thought":           "Not done after all",
+			"thoughtNumber":     3,
+			"totalThoughts":     3,
+			"nextThoughtNeeded": false,
+			"needsMoreThoughts": true,
+		}
+
+		data, err := validateThoughtData(args, Options{})
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if data.NextThoughtNeeded == nil || !*data.NextThoughtNeeded {
+			t.Errorf("Expected nextThoughtNeeded = true, got %v", data.NextThoughtNeeded)
+		}
+		if data.TotalThoughts != 4 {
+			t.Errorf("Expected totalThoughts = 4, got %d", data.TotalThoughts)
+		}
+		if data.ExtendedBy != 1 {
+			t.Errorf("Expected extendedBy = 1, got %d", data.ExtendedBy)
+		}
+	})
+
+	t.Run("revisesThought without isRevision", func(t *testing.T) {
+		args := map[string]any{
+			"thought":        "Test thought",
+			"thoughtNumber":  2,
+			"totalThoughts":  3,
+			"revisesThought": 1,
+		}
+
+		_, err := validateThoughtData(args, Options{})
+		if err == nil {
+			t.Fatal("Expected error for revisesThought without isRevision")
+		}
+		if !strings.Contains(err.Error(), "revisesThought requires isRevision") {
+			t.Errorf("Expected specific error message, got %v", err)
+		}
+	})
+
+	t.Run("isRevision without revisesThought", func(t *testing.T) {
+		args := map[string]any{
+			"thought":       "Test thought",
+			"thoughtNumber": 2,
+			"totalThoughts": 3,
+			"isRevision":    true,
+		}
+
+		_, err := validateThoughtData(args, Options{})
+		if err == nil {
+			t.Fatal("Expected error for isRevision without revisesThought")
+		}
+		if !strings.Contains(err.Error(), "isRevision requires revisesThought") {
+			t.Errorf("Expected specific error message, got %v", err)
+		}
+	})
+
+	t.Run("revising a future thought", func(t *testing.T) {
+		args := map[string]any{
+			"thought":        "Test thought",
+			"thoughtNumber":  2,
+			"totalThoughts":  3,
+			"isRevision":     true,
+			"revisesThought": 3,
+		}
+
+		_, err := validateThoughtData(args, Options{})
+		if err == nil {
+			t.Fatal("Expected error for revising a future thought")
+		}
+		if !strings.Contains(err.Error(), "only earlier thoughts can be revised") {
+			t.Errorf("Expected specific error message, got %v", err)
+		}
+	})
+
 	t.Run("invalid data type - thought as number", func(t *testing.T) {
 		args := map[string]any{
 			"thought":           123,
@@ -228,7 +343,7 @@ func TestValidateThoughtData(t *testing.T) {
 			"nextThoughtNeeded": true,
 		}
 
-		_, err := validateThoughtData(args)
+		_, err := validateThoughtData(args, Options{})
 		if err == nil {
 			t.Fatal("Expected error for invalid thought type")
 		}
@@ -342,27 +457,56 @@ func TestFormatThought(t *testing.T) {
 		}
 	})
 
-	t.Run("disabled logging", func(t *testing.T) {
-		// Set environment variable
-		err := os.Setenv("DISABLE_THOUGHT_LOGGING", "true")
-		if err != nil {
-			t.Fatalf("Failed to set environment variable: %v", err)
+	t.Run("extended estimate formatting", func(t *testing.T) {
+		data := &ThoughtData{
+			Thought:           "Going further",
+			ThoughtNumber:     5,
+			TotalThoughts:     5,
+			NextThoughtNeeded: ptr(false),
+			ExtendedBy:        2,
 		}
-		defer func() {
-			if err := os.Unsetenv("DISABLE_THOUGHT_LOGGING"); err != nil {
-				t.Logf("Failed to unset environment variable: %v", err)
-			}
-		}()
 
+		output := formatThought(data)
+
+		if !strings.Contains(output, "💭 Thought 5/5") {
+			t.Errorf("Expected adjusted header, got: %s", output)
+		}
+		if !strings.Contains(output, "📈 Estimate raised to 5 thoughts (+2)") {
+			t.Errorf("Expected extension indicator, got: %s", output)
+		}
+	})
+
+	t.Run("extending plan formatting", func(t *testing.T) {
 		data := &ThoughtData{
-			Thought:           "This should not appear",
-			ThoughtNumber:     1,
-			TotalThoughts:     3,
+			Thought:           "Need more room",
+			ThoughtNumber:     3,
+			TotalThoughts:     4,
 			NextThoughtNeeded: ptr(true),
+			NeedsMoreThoughts: ptr(true),
+			ExtendedBy:        1,
 		}
 
 		output := formatThought(data)
 
+		if !strings.Contains(output, "🔁 Extending plan to 4 thoughts (+1)") {
+			t.Errorf("Expected extending plan indicator, got: %s", output)
+		}
+		if strings.Contains(output, "📈") {
+			t.Errorf("Should not contain estimate indicator as well, got: %s", output)
+		}
+	})
+
+	t.Run("disabled logging", func(t *testing.T) {
+		handler := NewSequentialThinkingTool(NewThoughtStore(), Options{DisableThoughtLogging: true}).Callback
+
+		result := handler(map[string]any{
+			"thought":       "This should not appear",
+			"thoughtNumber": 1,
+			"totalThoughts": 3,
+		})
+
+		output := result.Content[0].(mcp.TextContent).Text
+
 		expected := "Thought logging is disabled."
 		if output != expected {
 			t.Errorf("Expected '%s', got '%s'", expected, output)
@@ -382,7 +526,7 @@ func TestAutomaticNextThoughtNeededCalculation(t *testing.T) {
 			// nextThoughtNeeded NOT provided - should be calculated automatically
 		}
 
-		data, err := validateThoughtData(args)
+		data, err := validateThoughtData(args, Options{})
 		if err != nil {
 			t.Fatalf("Expected no error, got %v", err)
 		}
@@ -401,7 +545,7 @@ func TestAutomaticNextThoughtNeededCalculation(t *testing.T) {
 			// nextThoughtNeeded NOT provided - should be calculated automatically
 		}
 
-		data, err := validateThoughtData(args)
+		data, err := validateThoughtData(args, Options{})
 		if err != nil {
 			t.Fatalf("Expected no error, got %v", err)
 		}
@@ -420,7 +564,7 @@ func TestAutomaticNextThoughtNeededCalculation(t *testing.T) {
 			"nextThoughtNeeded": false, // Explicit false despite 1 < 3
 		}
 
-		data, err := validateThoughtData(args)
+		data, err := validateThoughtData(args, Options{})
 		if err != nil {
 			t.Fatalf("Expected no error, got %v", err)
 		}
@@ -432,37 +576,7 @@ func TestAutomaticNextThoughtNeededCalculation(t *testing.T) {
 
 	t.Run("integration test with handler", func(t *testing.T) {
 		// Test the full flow including meta response
-		handler := func(args map[string]any) *mcp.CallToolResult {
-			data, err := validateThoughtData(args)
-			if err != nil {
-				return &mcp.CallToolResult{
-					IsError: ptr(true),
-					Content: []any{
-						mcp.TextContent{
-							Type: "text",
-							Text: fmt.Sprintf("Validation error: %v", err),
-						},
-					},
-				}
-			}
-
-			return &mcp.CallToolResult{
-				Content: []any{
-					mcp.TextContent{
-						Type: "text",
-						Text: formatThought(data),
-					},
-				},
-				IsError: ptr(false),
-				Meta: map[string]any{
-					"thoughtNumber":        data.ThoughtNumber,
-					"totalThoughts":        data.TotalThoughts,
-					"nextThoughtNeeded":    data.NextThoughtNeeded != nil && *data.NextThoughtNeeded,
-					"branches":             []any{},
-					"thoughtHistoryLength": 1,
-				},
-			}
-		}
+		handler := NewSequentialThinkingTool(NewThoughtStore(), Options{}).Callback
 
 		// Test automatic calculation in meta response
 		args := map[string]any{
@@ -496,7 +610,7 @@ func TestAutomaticNextThoughtNeededCalculation(t *testing.T) {
 
 func TestNewSequentialThinkingTool(t *testing.T) {
 	t.Run("tool creation", func(t *testing.T) {
-		tool := NewSequentialThinkingTool()
+		tool := NewSequentialThinkingTool(NewThoughtStore(), Options{})
 
 		// Test that tool is not nil
 		if tool == nil {
@@ -511,7 +625,7 @@ func TestNewSequentialThinkingTool(t *testing.T) {
 	})
 
 	t.Run("tool interface compliance", func(t *testing.T) {
-		tool := NewSequentialThinkingTool()
+		tool := NewSequentialThinkingTool(NewThoughtStore(), Options{})
 
 		// Verify tool is valid (interface compliance tested through usage)
 		_ = tool
@@ -538,7 +652,7 @@ func TestNewSequentialThinkingTool(t *testing.T) {
 	})
 
 	t.Run("tool definition validation", func(t *testing.T) {
-		tool := NewSequentialThinkingTool()
+		tool := NewSequentialThinkingTool(NewThoughtStore(), Options{})
 
 		// Get the tool definition through reflection to validate the MCP tool structure
 		toolValue := reflect.ValueOf(tool)
@@ -558,7 +672,7 @@ func TestNewSequentialThinkingTool(t *testing.T) {
 	t.Run("mcp tool properties", func(t *testing.T) {
 		// Create multiple tools to exercise the NewSequentialThinkingTool function more thoroughly
 		for i := 0; i < 3; i++ {
-			tool := NewSequentialThinkingTool()
+			tool := NewSequentialThinkingTool(NewThoughtStore(), Options{})
 			if tool == nil {
 				t.Errorf("Tool %d should not be nil", i)
 			}
@@ -677,37 +791,7 @@ func TestNewSequentialThinkingTool(t *testing.T) {
 func TestSequentialThinkingToolHandler(t *testing.T) {
 	// Extract the handler function from NewSequentialThinkingTool
 	// We'll test the handler function directly since it contains the core logic
-	handler := func(args map[string]any) *mcp.CallToolResult {
-		data, err := validateThoughtData(args)
-		if err != nil {
-			return &mcp.CallToolResult{
-				IsError: ptr(true),
-				Content: []any{
-					mcp.TextContent{
-						Type: "text",
-						Text: fmt.Sprintf("Validation error: %v", err),
-					},
-				},
-			}
-		}
-
-		return &mcp.CallToolResult{
-			Content: []any{
-				mcp.TextContent{
-					Type: "text",
-					Text: formatThought(data),
-				},
-			},
-			IsError: ptr(false),
-			Meta: map[string]any{
-				"thoughtNumber":        data.ThoughtNumber,
-				"totalThoughts":        data.TotalThoughts,
-				"nextThoughtNeeded":    data.NextThoughtNeeded != nil && *data.NextThoughtNeeded,
-				"branches":             []any{},
-				"thoughtHistoryLength": 1,
-			},
-		}
-	}
+	handler := NewSequentialThinkingTool(NewThoughtStore(), Options{}).Callback
 
 	t.Run("successful tool execution", func(t *testing.T) {
 		// Create valid arguments
@@ -757,7 +841,7 @@ func TestSequentialThinkingToolHandler(t *testing.T) {
 			}
 			if branches, ok := result.Meta["branches"]; !ok {
 				t.Error("Expected branches in meta")
-			} else if branchSlice := branches.([]any); len(branchSlice) != 0 {
+			} else if branchSlice := branches.([]BranchStatus); len(branchSlice) != 0 {
 				t.Errorf("Expected empty branches array, got %v", branches)
 			}
 			if histLen, ok := result.Meta["thoughtHistoryLength"]; !ok || histLen != 1 {
@@ -853,7 +937,7 @@ func TestSequentialThinkingToolHandler(t *testing.T) {
 func TestNewSequentialThinkingToolComprehensive(t *testing.T) {
 	t.Run("complete tool functionality", func(t *testing.T) {
 		// This test aims to exercise all branches in NewSequentialThinkingTool
-		tool := NewSequentialThinkingTool()
+		tool := NewSequentialThinkingTool(NewThoughtStore(), Options{})
 
 		// Test the tool structure by calling it with various inputs
 		// to trigger different code paths in the handler function
@@ -918,37 +1002,7 @@ func TestNewSequentialThinkingToolComprehensive(t *testing.T) {
 
 		// If we can't find the Call method, we'll test the handler function directly
 		// This still exercises the NewSequentialThinkingTool code path
-		handler := func(args map[string]any) *mcp.CallToolResult {
-			data, err := validateThoughtData(args)
-			if err != nil {
-				return &mcp.CallToolResult{
-					IsError: ptr(true),
-					Content: []any{
-						mcp.TextContent{
-							Type: "text",
-							Text: fmt.Sprintf("Validation error: %v", err),
-						},
-					},
-				}
-			}
-
-			return &mcp.CallToolResult{
-				Content: []any{
-					mcp.TextContent{
-						Type: "text",
-						Text: formatThought(data),
-					},
-				},
-				IsError: ptr(false),
-				Meta: map[string]any{
-					"thoughtNumber":        data.ThoughtNumber,
-					"totalThoughts":        data.TotalThoughts,
-					"nextThoughtNeeded":    data.NextThoughtNeeded != nil && *data.NextThoughtNeeded,
-					"branches":             []any{},
-					"thoughtHistoryLength": 1,
-				},
-			}
-		}
+		handler := NewSequentialThinkingTool(NewThoughtStore(), Options{}).Callback
 
 		// Test all cases to exercise the NewSequentialThinkingTool logic
 		for _, tc := range testCases {
@@ -976,7 +1030,7 @@ func TestMainComponents(t *testing.T) {
 		// we'll test the components that main() uses to ensure they work correctly
 
 		// Test NewSequentialThinkingTool creation (main calls this)
-		tool := NewSequentialThinkingTool()
+		tool := NewSequentialThinkingTool(NewThoughtStore(), Options{})
 		if tool == nil {
 			t.Error("NewSequentialThinkingTool should not return nil")
 		}
@@ -1025,7 +1079,7 @@ func BenchmarkValidateThoughtData(b *testing.B) {
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		_, err := validateThoughtData(args)
+		_, err := validateThoughtData(args, Options{})
 		if err != nil {
 			b.Fatal(err)
 		}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+	bolterrors "go.etcd.io/bbolt/errors"
+)
+
+// Persister durably records thoughts so that sessions survive restarts.
+type Persister interface {
+	// Load returns the thoughts recorded for every session, in the order
+	// they were appended.
+	Load() (map[string][]ThoughtData, error)
+	// Append records a thought of a session. The thought must be durable
+	// once Append returns.
+	Append(sessionID string, data ThoughtData) error
+	// Delete removes everything recorded for a session.
+	Delete(sessionID string) error
+	Close() error
+}
+
+// newPersister creates the persistence backend called kind, storing its data
+// at path. The memory backend keeps nothing and is returned as nil.
+func newPersister(kind, path string) (Persister, error) {
+	switch kind {
+	case "memory":
+		return nil, nil
+	case "jsonl":
+		return NewJSONLPersister(path)
+	case "bolt":
+		return NewBoltPersister(path)
+	}
+	return nil, fmt.Errorf("unknown storage %q, expected memory, jsonl or bolt", kind)
+}
+
+const jsonlExt = ".jsonl"
+
+// jsonlPersister appends every thought as a JSON line to a file per session
+// in a directory. Appends to one session are expected to come one at a time,
+// as the store makes them.
+type jsonlPersister struct {
+	dir string
+
+	mu    sync.Mutex
+	files map[string]*os.File
+}
+
+// NewJSONLPersister creates a persister that keeps one append-only JSONL file
+// per session in dir, creating dir if needed.
+func NewJSONLPersister(dir string) (Persister, error) {
+	// Sessions hold whatever the model reasoned about, so they are kept
+	// private to the user running the server.
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("failed to create storage directory: %v", err)
+	}
+	return &jsonlPersister{dir: dir, files: make(map[string]*os.File)}, nil
+}
+
+// sessionPath escapes the session id, so that any id maps to a file inside
+// the directory.
+func (p *jsonlPersister) sessionPath(sessionID string) string {
+	return filepath.Join(p.dir, url.PathEscape(sessionID)+jsonlExt)
+}
+
+func (p *jsonlPersister) Load() (map[string][]ThoughtData, error) {
+	entries, err := os.ReadDir(p.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read storage directory: %v", err)
+	}
+
+	sessions := make(map[string][]ThoughtData)
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, jsonlExt) {
+			continue
+		}
+		sessionID, err := url.PathUnescape(strings.TrimSuffix(name, jsonlExt))
+		if err != nil {
+			continue
+		}
+
+		thoughts, err := p.loadFile(filepath.Join(p.dir, name))
+		if err != nil {
+			return nil, err
+		}
+		if len(thoughts) > 0 {
+			sessions[sessionID] = thoughts
+		}
+	}
+	return sessions, nil
+}
+
+func (p *jsonlPersister) loadFile(path string) ([]ThoughtData, error) {
+	content, err := os.ReadFile(path) //nolint:gosec // G304: a session file inside the configured storage directory
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", path, err)
+	}
+
+	// A crash while appending can leave a partial last line behind. It was
+	// never acknowledged, so it is skipped here and cut off before the file
+	// is appended to again.
+	content = content[:bytes.LastIndexByte(content, '\n')+1]
+
+	var thoughts []ThoughtData
+	for n, line := range bytes.Split(content, []byte("\n")) {
+		if len(line) == 0 {
+			continue
+		}
+		var data ThoughtData
+		if err := json.Unmarshal(line, &data); err != nil {
+			return nil, fmt.Errorf("failed to parse %s line %d: %v", path, n+1, err)
+		}
+		thoughts = append(thoughts, data)
+	}
+	return thoughts, nil
+}
+
+func (p *jsonlPersister) Append(sessionID string, data ThoughtData) error {
+	line, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	f, err := p.file(sessionID)
+	if err != nil {
+		return err
+	}
+
+	// The lock only covers the set of files, so sessions are written and
+	// synced in parallel. A single write keeps the line in one piece.
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+func (p *jsonlPersister) file(sessionID string) (*os.File, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if f, ok := p.files[sessionID]; ok {
+		return f, nil
+	}
+
+	path := p.sessionPath(sessionID)
+	if err := repairTail(path); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600) //nolint:gosec // G304: sessionPath escapes the session id into the storage directory
+	if err != nil {
+		return nil, err
+	}
+	p.files[sessionID] = f
+	return f, nil
+}
+
+// repairTail cuts off a partial last line left behind by a crash, so that
+// the next line appended starts on a line of its own.
+func repairTail(path string) error {
+	content, err := os.ReadFile(path) //nolint:gosec // G304: a session file inside the configured storage directory
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if end := bytes.LastIndexByte(content, '\n') + 1; end < len(content) {
+		return os.Truncate(path, int64(end))
+	}
+	return nil
+}
+
+func (p *jsonlPersister) Delete(sessionID string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if f, ok := p.files[sessionID]; ok {
+		_ = f.Close()
+		delete(p.files, sessionID)
+	}
+	if err := os.Remove(p.sessionPath(sessionID)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (p *jsonlPersister) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var firstErr error
+	for id, f := range p.files {
+		if err := f.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		delete(p.files, id)
+	}
+	return firstErr
+}
+
+// boltPersister keeps a bucket per session in a bbolt database, with thoughts
+// keyed by their big-endian sequence number.
+type boltPersister struct {
+	db *bolt.DB
+}
+
+// NewBoltPersister creates a persister backed by the bbolt database at path.
+func NewBoltPersister(path string) (Persister, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return nil, fmt.Errorf("failed to create storage directory: %v", err)
+	}
+	// The database is locked by the process that opened it, so a second
+	// server on the same file fails instead of waiting forever.
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %v", path, err)
+	}
+	return &boltPersister{db: db}, nil
+}
+
+func (p *boltPersister) Load() (map[string][]ThoughtData, error) {
+	sessions := make(map[string][]ThoughtData)
+	err := p.db.View(func(tx *bolt.Tx) error {
+		return tx.ForEach(func(name []byte, b *bolt.Bucket) error {
+			return b.ForEach(func(_, v []byte) error {
+				var data ThoughtData
+				if err := json.Unmarshal(v, &data); err != nil {
+					return fmt.Errorf("failed to parse thought of session %q: %v", name, err)
+				}
+				sessions[string(name)] = append(sessions[string(name)], data)
+				return nil
+			})
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+func (p *boltPersister) Append(sessionID string, data ThoughtData) error {
+	value, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	return p.db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(sessionID))
+		if err != nil {
+			return err
+		}
+		seq, err := b.NextSequence()
+		if err != nil {
+			return err
+		}
+		return b.Put(binary.BigEndian.AppendUint64(nil, seq), value)
+	})
+}
+
+func (p *boltPersister) Delete(sessionID string) error {
+	return p.db.Update(func(tx *bolt.Tx) error {
+		err := tx.DeleteBucket([]byte(sessionID))
+		if errors.Is(err, bolterrors.ErrBucketNotFound) {
+			return nil
+		}
+		return err
+	})
+}
+
+func (p *boltPersister) Close() error {
+	return p.db.Close()
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPersisters(t *testing.T) {
+	backends := []struct {
+		name string
+		open func(t *testing.T, dir string) Persister
+	}{
+		{
+			name: "jsonl",
+			open: func(t *testing.T, dir string) Persister {
+				p, err := NewJSONLPersister(dir)
+				if err != nil {
+					t.Fatalf("Failed to open persister: %v", err)
+				}
+				return p
+			},
+		},
+		{
+			name: "bolt",
+			open: func(t *testing.T, dir string) Persister {
+				p, err := NewBoltPersister(filepath.Join(dir, "thoughts.db"))
+				if err != nil {
+					t.Fatalf("Failed to open persister: %v", err)
+				}
+				return p
+			},
+		},
+	}
+
+	for _, backend := range backends {
+		t.Run(backend.name, func(t *testing.T) {
+			dir := t.TempDir()
+
+			p := backend.open(t, dir)
+			thoughts := []ThoughtData{
+				{Thought: "first", ThoughtNumber: 1, TotalThoughts: 3},
+				{Thought: "second", ThoughtNumber: 2, TotalThoughts: 3},
+				{Thought: "alt", ThoughtNumber: 3, TotalThoughts: 3, BranchFromThought: ptr(1), BranchID: "alt"},
+			}
+			for _, data := range thoughts {
+				if err := p.Append("team/a", data); err != nil {
+					t.Fatalf("Failed to append: %v", err)
+				}
+			}
+			if err := p.Append(defaultSessionID, thoughts[0]); err != nil {
+				t.Fatalf("Failed to append: %v", err)
+			}
+			if err := p.Close(); err != nil {
+				t.Fatalf("Failed to close: %v", err)
+			}
+
+			p = backend.open(t, dir)
+			defer func() { _ = p.Close() }()
+
+			sessions, err := p.Load()
+			if err != nil {
+				t.Fatalf("Failed to load: %v", err)
+			}
+			if len(sessions) != 2 || len(sessions[defaultSessionID]) != 1 {
+				t.Fatalf("Expected 2 sessions, got %v", sessions)
+			}
+			loaded := sessions["team/a"]
+			if len(loaded) != len(thoughts) {
+				t.Fatalf("Expected %d thoughts, got %d", len(thoughts), len(loaded))
+			}
+			for i, data := range loaded {
+				if data.Thought != thoughts[i].Thought || data.ThoughtNumber != thoughts[i].ThoughtNumber {
+					t.Errorf("Expected thought %d to be %+v, got %+v", i, thoughts[i], data)
+				}
+			}
+			if loaded[2].BranchID != "alt" || loaded[2].BranchFromThought == nil || *loaded[2].BranchFromThought != 1 {
+				t.Errorf("Expected branch fields to survive, got %+v", loaded[2])
+			}
+
+			if err := p.Delete("team/a"); err != nil {
+				t.Fatalf("Failed to delete: %v", err)
+			}
+			if err := p.Delete("never-recorded"); err != nil {
+				t.Errorf("Expected deleting an unknown session to succeed, got %v", err)
+			}
+			if sessions, err = p.Load(); err != nil || len(sessions) != 1 {
+				t.Errorf("Expected only the default session after delete, got %v (%v)", sessions, err)
+			}
+		})
+	}
+}
+
+func TestJSONLPersisterPartialLine(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, defaultSessionID+jsonlExt)
+	content := `{"thought":"kept","thoughtNumber":1,"totalThoughts":2}` + "\n" + `{"thought":"cut`
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	p, err := NewJSONLPersister(dir)
+	if err != nil {
+		t.Fatalf("Failed to open persister: %v", err)
+	}
+	defer func() { _ = p.Close() }()
+
+	sessions, err := p.Load()
+	if err != nil {
+		t.Fatalf("Expected partial line to be dropped, got %v", err)
+	}
+	if len(sessions[defaultSessionID]) != 1 {
+		t.Fatalf("Expected 1 thought, got %v", sessions[defaultSessionID])
+	}
+
+	if err := p.Append(defaultSessionID, ThoughtData{Thought: "next", ThoughtNumber: 2, TotalThoughts: 2}); err != nil {
+		t.Fatalf("Failed to append: %v", err)
+	}
+	if sessions, err = p.Load(); err != nil || len(sessions[defaultSessionID]) != 2 {
+		t.Errorf("Expected 2 thoughts after append, got %v (%v)", sessions[defaultSessionID], err)
+	}
+}
+
+func TestThoughtStoreRestore(t *testing.T) {
+	dir := t.TempDir()
+
+	p, err := NewJSONLPersister(dir)
+	if err != nil {
+		t.Fatalf("Failed to open persister: %v", err)
+	}
+	store := NewThoughtStore()
+	if err := store.Restore(p); err != nil {
+		t.Fatalf("Failed to restore: %v", err)
+	}
+	handler := NewSequentialThinkingTool(store, Options{}).Callback
+	handler(map[string]any{"thought": "one", "thoughtNumber": 1, "totalThoughts": 2})
+	handler(map[string]any{"thought": "alt", "thoughtNumber": 2, "totalThoughts": 2, "branchFromThought": 1, "branchId": "b", "branchState": "chosen"})
+	_ = p.Close()
+
+	// A new process picks up where the previous one stopped.
+	p, err = NewJSONLPersister(dir)
+	if err != nil {
+		t.Fatalf("Failed to open persister: %v", err)
+	}
+	defer func() { _ = p.Close() }()
+	store = NewThoughtStore()
+	if err := store.Restore(p); err != nil {
+		t.Fatalf("Failed to restore: %v", err)
+	}
+
+	if history := store.History(defaultSessionID); len(history) != 2 {
+		t.Fatalf("Expected 2 restored thoughts, got %d", len(history))
+	}
+	if branches := store.Branches(defaultSessionID); len(branches) != 1 || branches[0].FromThought != 1 || branches[0].State != BranchChosen {
+		t.Errorf("Expected restored branch b from thought 1, chosen, got %v", branches)
+	}
+
+	result := NewSequentialThinkingTool(store, Options{}).Callback(map[string]any{"thought": "more", "thoughtNumber": 3, "totalThoughts": 3, "branchId": "b"})
+	if histLen := result.Meta["thoughtHistoryLength"]; histLen != 3 {
+		t.Errorf("Expected restored branch to be continued, got history length %v", histLen)
+	}
+
+	t.Run("inconsistent file", func(t *testing.T) {
+		dir := t.TempDir()
+		content := `{"thought":"orphan","thoughtNumber":1,"totalThoughts":1,"branchId":"nowhere"}` + "\n"
+		if err := os.WriteFile(filepath.Join(dir, defaultSessionID+jsonlExt), []byte(content), 0o600); err != nil {
+			t.Fatalf("Failed to write file: %v", err)
+		}
+
+		p, err := NewJSONLPersister(dir)
+		if err != nil {
+			t.Fatalf("Failed to open persister: %v", err)
+		}
+		defer func() { _ = p.Close() }()
+
+		err = NewThoughtStore().Restore(p)
+		if err == nil || !strings.Contains(err.Error(), "does not exist") {
+			t.Errorf("Expected restore to fail on an unknown branch, got %v", err)
+		}
+	})
+}
+
+func TestNewPersister(t *testing.T) {
+	if p, err := newPersister("memory", ""); p != nil || err != nil {
+		t.Errorf("Expected no persister for memory storage, got %v %v", p, err)
+	}
+	if _, err := newPersister("tape", ""); err == nil {
+		t.Error("Expected error for unknown storage")
+	}
+}
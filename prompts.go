@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/strowk/foxy-contexts/pkg/fxctx"
+	"github.com/strowk/foxy-contexts/pkg/mcp"
+)
+
+// thinkingWorkflow describes a prompt that seeds a sequential_thinking run.
+type thinkingWorkflow struct {
+	name          string
+	description   string
+	goal          string
+	totalThoughts int
+	steps         []string
+	branches      string
+}
+
+var thinkingWorkflows = []thinkingWorkflow{
+	{
+		name:          "debug-problem",
+		description:   "Debug a failing behaviour step by step",
+		goal:          "Find out why the following problem happens and how to fix it",
+		totalThoughts: 6,
+		steps: []string{
+			"Restate the observed and the expected behaviour.",
+			"List the components involved and what each one should be doing.",
+			"Form a hypothesis about the cause and name the evidence that would confirm it.",
+			"Check the hypothesis against the evidence; revise earlier thoughts with isRevision when it fails.",
+			"Propose the smallest fix and how to verify it.",
+		},
+		branches: "Open one branch per competing hypothesis, using branchId values like \"hypothesis-a\", \"hypothesis-b\", each branching from the thought that listed the components.",
+	},
+	{
+		name:          "design-review",
+		description:   "Review a design or proposal for risks and alternatives",
+		goal:          "Review the following design",
+		totalThoughts: 8,
+		steps: []string{
+			"Summarise the goals and constraints of the design.",
+			"Walk through the main flows and note where they could fail.",
+			"Look at performance, security, operability and maintenance in turn.",
+			"Weigh the alternatives against the original design.",
+			"Finish with a recommendation and the open questions.",
+		},
+		branches: "Explore each alternative design on its own branch, with branchId values like \"alt-<short-name>\", branching from the thought that summarised the goals.",
+	},
+	{
+		name:          "hypothesis-test",
+		description:   "Generate and verify hypotheses about a question",
+		goal:          "Answer the following question by generating and testing hypotheses",
+		totalThoughts: 5,
+		steps: []string{
+			"State the question precisely and what an answer must explain.",
+			"Generate a few candidate hypotheses.",
+			"For each hypothesis, derive a prediction and check it.",
+			"Keep the hypothesis that survives and state how confident you are.",
+		},
+		branches: "Test each hypothesis on its own branch with branchId \"h1\", \"h2\" and so on, all branching from the thought that listed the candidates.",
+	},
+	{
+		name:          "root-cause",
+		description:   "Trace an incident back to its root cause",
+		goal:          "Find the root cause of the following incident",
+		totalThoughts: 7,
+		steps: []string{
+			"Lay out the timeline of what happened.",
+			"Separate symptoms from causes.",
+			"Ask \"why\" for each cause until it stops yielding new answers.",
+			"Check that the root cause explains every symptom; revise earlier thoughts when it does not.",
+			"Name corrective actions for the root cause and the contributing factors.",
+		},
+		branches: "When a \"why\" has more than one answer, follow each on its own branch with branchId \"why-<n>-<short-name>\", branching from the thought that asked it.",
+	},
+}
+
+// NewThinkingPrompts creates the prompts that seed common sequential
+// thinking workflows.
+func NewThinkingPrompts() []fxctx.Prompt {
+	prompts := make([]fxctx.Prompt, 0, len(thinkingWorkflows))
+	for _, w := range thinkingWorkflows {
+		prompts = append(prompts, fxctx.NewPrompt(
+			mcp.Prompt{
+				Name:        w.name,
+				Description: ptr(w.description),
+				Arguments: []mcp.PromptArgument{
+					{
+						Name:        "problem",
+						Description: ptr("The problem to think through"),
+						Required:    ptr(true),
+					},
+					{
+						Name:        "context",
+						Description: ptr("Additional background, constraints or material to consider"),
+						Required:    ptr(false),
+					},
+				},
+			},
+			func(req *mcp.GetPromptRequest) (*mcp.GetPromptResult, error) {
+				problem := req.Params.Arguments["problem"]
+				if problem == "" {
+					return nil, fmt.Errorf("argument problem is required")
+				}
+
+				return &mcp.GetPromptResult{
+					Description: ptr(w.description),
+					Messages: []mcp.PromptMessage{
+						{
+							Role: mcp.RoleUser,
+							Content: mcp.TextContent{
+								Type: "text",
+								Text: w.message(problem, req.Params.Arguments["context"]),
+							},
+						},
+					},
+				}, nil
+			},
+		))
+	}
+	return prompts
+}
+
+func (w thinkingWorkflow) message(problem, context string) string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "%s:\n\n%s\n", w.goal, problem)
+	if context != "" {
+		fmt.Fprintf(&b, "\nContext:\n\n%s\n", context)
+	}
+
+	fmt.Fprintf(&b, "\nWork through it with the sequential_thinking tool, one call per thought. Start with thoughtNumber 1 and totalThoughts %d, and adjust totalThoughts as your understanding changes.\n", w.totalThoughts)
+
+	b.WriteString("\nSuggested progression:\n")
+	for i, step := range w.steps {
+		fmt.Fprintf(&b, "%d. %s\n", i+1, step)
+	}
+
+	fmt.Fprintf(&b, "\nBranches: %s\n", w.branches)
+	b.WriteString("\nSet needsMoreThoughts when you reach the end but are not done, and set nextThoughtNeeded to false only once you have a final answer.\n")
+
+	return b.String()
+}
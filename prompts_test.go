@@ -0,0 +1,67 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/strowk/foxy-contexts/pkg/mcp"
+)
+
+func TestThinkingPrompts(t *testing.T) {
+	prompts := NewThinkingPrompts()
+
+	t.Run("registers every workflow", func(t *testing.T) {
+		names := map[string]bool{}
+		for _, p := range prompts {
+			names[p.GetMcpPrompt().Name] = true
+		}
+		for _, name := range []string{"debug-problem", "design-review", "hypothesis-test", "root-cause"} {
+			if !names[name] {
+				t.Errorf("Expected prompt %s, got %v", name, names)
+			}
+		}
+	})
+
+	t.Run("seeds the sequential_thinking workflow", func(t *testing.T) {
+		for _, p := range prompts {
+			name := p.GetMcpPrompt().Name
+			result, err := p.Get(&mcp.GetPromptRequest{
+				Params: mcp.GetPromptRequestParams{
+					Name: name,
+					Arguments: mcp.GetPromptRequestParamsArguments{
+						"problem": "The nightly build fails intermittently",
+						"context": "Started after the CI runner upgrade",
+					},
+				},
+			})
+			if err != nil {
+				t.Fatalf("%s: expected no error, got %v", name, err)
+			}
+			if len(result.Messages) != 1 || result.Messages[0].Role != mcp.RoleUser {
+				t.Fatalf("%s: expected a single user message, got %+v", name, result.Messages)
+			}
+
+			text := result.Messages[0].Content.(mcp.TextContent).Text
+			for _, want := range []string{
+				"The nightly build fails intermittently",
+				"Started after the CI runner upgrade",
+				"sequential_thinking",
+				"totalThoughts",
+				"branchId",
+			} {
+				if !strings.Contains(text, want) {
+					t.Errorf("%s: expected message to contain '%s', got: %s", name, want, text)
+				}
+			}
+		}
+	})
+
+	t.Run("requires a problem", func(t *testing.T) {
+		_, err := prompts[0].Get(&mcp.GetPromptRequest{
+			Params: mcp.GetPromptRequestParams{Name: prompts[0].GetMcpPrompt().Name},
+		})
+		if err == nil {
+			t.Fatal("Expected error for missing problem")
+		}
+	})
+}
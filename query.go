@@ -0,0 +1,272 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/strowk/foxy-contexts/pkg/fxctx"
+	"github.com/strowk/foxy-contexts/pkg/mcp"
+)
+
+// ThoughtQuery selects recorded thoughts of a session. Zero fields do not
+// filter.
+type ThoughtQuery struct {
+	// FromThought and ToThought bound the thought numbers, inclusively.
+	FromThought int
+	ToThought   int
+	// BranchID keeps the thoughts of one branch, MainLine the thoughts of
+	// no branch.
+	BranchID string
+	MainLine bool
+	// IsRevision keeps only revisions if true, and only thoughts that are
+	// not revisions if false.
+	IsRevision *bool
+	// Contains keeps thoughts whose text contains it, ignoring case.
+	Contains string
+	// Pattern keeps thoughts whose text it matches.
+	Pattern *regexp.Regexp
+	// Limit keeps the latest matches only, if positive.
+	Limit int
+}
+
+// Matches reports whether a thought is selected by the query.
+func (q *ThoughtQuery) Matches(t *ThoughtData) bool {
+	switch {
+	case q.FromThought > 0 && t.ThoughtNumber < q.FromThought,
+		q.ToThought > 0 && t.ThoughtNumber > q.ToThought,
+		q.BranchID != "" && t.BranchID != q.BranchID,
+		q.MainLine && t.BranchID != "",
+		q.IsRevision != nil && *q.IsRevision != (t.RevisesThought != nil),
+		q.Contains != "" && !strings.Contains(strings.ToLower(t.Thought), strings.ToLower(q.Contains)),
+		q.Pattern != nil && !q.Pattern.MatchString(t.Thought):
+		return false
+	}
+	return true
+}
+
+// Select returns the thoughts of history selected by the query, in the
+// order they were recorded.
+func (q *ThoughtQuery) Select(history []ThoughtData) []ThoughtData {
+	var matches []ThoughtData
+	for i := range history {
+		if q.Matches(&history[i]) {
+			matches = append(matches, history[i])
+		}
+	}
+	if q.Limit > 0 && len(matches) > q.Limit {
+		matches = matches[len(matches)-q.Limit:]
+	}
+	return matches
+}
+
+// parseThoughtQuery reads a query from the arguments of get_thoughts. It
+// reports every invalid argument at once.
+func parseThoughtQuery(args map[string]any) (ThoughtQuery, error) {
+	var q ThoughtQuery
+	var fields []FieldError
+	check := func(err error) {
+		if err != nil {
+			fields = append(fields, fieldErrors(err)...)
+		}
+	}
+
+	var err error
+	q.FromThought, err = intArg(args, "fromThought")
+	check(err)
+	q.ToThought, err = intArg(args, "toThought")
+	check(err)
+	q.BranchID, err = stringArg(args, "branchId")
+	check(err)
+	mainLine, err := boolArg(args, "mainLine")
+	check(err)
+	q.MainLine = mainLine != nil && *mainLine
+	q.IsRevision, err = boolArg(args, "isRevision")
+	check(err)
+	q.Contains, err = stringArg(args, "contains")
+	check(err)
+	pattern, err := stringArg(args, "pattern")
+	check(err)
+	q.Limit, err = intArg(args, "limit")
+	check(err)
+
+	if q.MainLine && q.BranchID != "" {
+		fields = append(fields, FieldError{
+			Field:   "mainLine",
+			Rule:    "conflict",
+			Message: "mainLine and branchId cannot be combined",
+			Value:   true,
+		})
+	}
+	if q.FromThought > 0 && q.ToThought > 0 && q.FromThought > q.ToThought {
+		fields = append(fields, FieldError{
+			Field:   "toThought",
+			Rule:    "min",
+			Message: fmt.Sprintf("toThought %d is below fromThought %d", q.ToThought, q.FromThought),
+			Value:   q.ToThought,
+		})
+	}
+	if pattern != "" {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			fields = append(fields, FieldError{
+				Field:   "pattern",
+				Rule:    "pattern",
+				Message: fmt.Sprintf("invalid pattern: %v", err),
+				Value:   pattern,
+			})
+		}
+		q.Pattern = re
+	}
+
+	if len(fields) > 0 {
+		return ThoughtQuery{}, &InputError{Summary: "invalid query", Fields: fields}
+	}
+	return q, nil
+}
+
+func stringArg(args map[string]any, name string) (string, error) {
+	v, ok := args[name]
+	if !ok || v == nil {
+		return "", nil
+	}
+	s, ok := v.(string)
+	if !ok {
+		return "", fieldError(typeError(name, "a string", v))
+	}
+	return s, nil
+}
+
+// intArg reads an optional argument that must be at least 1 if given.
+func intArg(args map[string]any, name string) (int, error) {
+	v, ok := args[name]
+	if !ok || v == nil {
+		return 0, nil
+	}
+	n, ok := asInt(v)
+	if !ok {
+		return 0, fieldError(typeError(name, "an integer", v))
+	}
+	if n < 1 {
+		return 0, fieldError(minError(name, n))
+	}
+	return n, nil
+}
+
+func boolArg(args map[string]any, name string) (*bool, error) {
+	v, ok := args[name]
+	if !ok || v == nil {
+		return nil, nil
+	}
+	b, ok := v.(bool)
+	if !ok {
+		return nil, fieldError(typeError(name, "a boolean", v))
+	}
+	return &b, nil
+}
+
+// NewGetThoughtsTool creates the tool that fetches recorded thoughts, so that
+// a model can re-read earlier steps that fell out of its context.
+func NewGetThoughtsTool(store *ThoughtStore, opts Options) fxctx.Tool {
+	return fxctx.NewTool(
+		&mcp.Tool{
+			Name:        "get_thoughts",
+			Description: ptr("Fetch thoughts recorded earlier in a session, to re-read a step before revising or branching from it. Thoughts can be filtered by number range, branch, revision status and text."),
+			InputSchema: mcp.ToolInputSchema{
+				Type: "object",
+				Properties: map[string]map[string]any{
+					"sessionId": {
+						"type":        "string",
+						"description": "Session to read; defaults to the session that most recently recorded a thought, and is required on servers shared over http or sse",
+					},
+					"fromThought": {
+						"type":        "integer",
+						"minimum":     1,
+						"description": "Lowest thought number to return",
+					},
+					"toThought": {
+						"type":        "integer",
+						"minimum":     1,
+						"description": "Highest thought number to return",
+					},
+					"branchId": {
+						"type":        "string",
+						"description": "Only return thoughts of this branch",
+					},
+					"mainLine": {
+						"type":        "boolean",
+						"description": "Only return thoughts that are not on a branch",
+					},
+					"isRevision": {
+						"type":        "boolean",
+						"description": "Only return revisions if true, only thoughts that are not revisions if false",
+					},
+					"contains": {
+						"type":        "string",
+						"description": "Only return thoughts containing this text, ignoring case",
+					},
+					"pattern": {
+						"type":        "string",
+						"description": "Only return thoughts matching this regular expression (RE2 syntax, prefix with (?i) to ignore case)",
+					},
+					"limit": {
+						"type":        "integer",
+						"minimum":     1,
+						"description": "Return at most this many of the latest matching thoughts",
+					},
+					"format": {
+						"type":        "string",
+						"enum":        renderFormats,
+						"description": "How to render the thoughts, defaulting to the format of sequential_thinking responses",
+					},
+				},
+			},
+		},
+		func(args map[string]any) *mcp.CallToolResult {
+			sessionID, err := stringArg(args, "sessionId")
+			if err != nil {
+				return toolErrorResult(err)
+			}
+			sessionID, err = store.SessionOrCurrent(sessionID)
+			if err != nil {
+				return toolErrorResult(err)
+			}
+
+			format, err := stringArg(args, "format")
+			if err != nil {
+				return toolErrorResult(err)
+			}
+			if format == "" {
+				format = opts.Format
+			}
+			renderer, err := rendererFor(format)
+			if err != nil {
+				return toolErrorResult(err)
+			}
+
+			q, err := parseThoughtQuery(args)
+			if err != nil {
+				return toolErrorResult(err)
+			}
+
+			history := store.History(sessionID)
+			if len(history) == 0 {
+				return toolErrorResult(fmt.Errorf("session %q has no recorded thoughts", sessionID))
+			}
+			matches := q.Select(history)
+
+			var b strings.Builder
+			fmt.Fprintf(&b, "Session %s: %d of %d thoughts match.\n", sessionID, len(matches), len(history))
+			for i := range matches {
+				b.WriteString("\n")
+				b.WriteString(renderer.Render(&matches[i]))
+			}
+
+			return textResult(b.String(), map[string]any{
+				"sessionId":            sessionID,
+				"matched":              len(matches),
+				"thoughtHistoryLength": len(history),
+			})
+		},
+	)
+}
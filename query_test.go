@@ -0,0 +1,118 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func newQueryStore(t *testing.T) *ThoughtStore {
+	t.Helper()
+
+	return recordSession(t, Options{ExtendTotal: true}, "design",
+		map[string]any{"thought": "Collect the requirements", "thoughtNumber": 1, "totalThoughts": 4},
+		map[string]any{"thought": "Pick a database", "thoughtNumber": 2, "totalThoughts": 4},
+		map[string]any{"thought": "Try a key-value store", "thoughtNumber": 3, "totalThoughts": 4, "branchFromThought": 2, "branchId": "kv"},
+		map[string]any{"thought": "Pick Postgres after all", "thoughtNumber": 3, "totalThoughts": 4, "isRevision": true, "revisesThought": 2},
+		map[string]any{"thought": "Write the schema", "thoughtNumber": 4, "totalThoughts": 4},
+	)
+}
+
+func TestThoughtQuery(t *testing.T) {
+	history := newQueryStore(t).History("design")
+
+	testCases := []struct {
+		name string
+		args map[string]any
+		want []string
+	}{
+		{name: "everything", args: map[string]any{}, want: []string{"Collect the requirements", "Pick a database", "Try a key-value store", "Pick Postgres after all", "Write the schema"}},
+		{name: "range", args: map[string]any{"fromThought": 2, "toThought": 3}, want: []string{"Pick a database", "Try a key-value store", "Pick Postgres after all"}},
+		{name: "branch", args: map[string]any{"branchId": "kv"}, want: []string{"Try a key-value store"}},
+		{name: "main line", args: map[string]any{"mainLine": true, "fromThought": 3}, want: []string{"Pick Postgres after all", "Write the schema"}},
+		{name: "revisions", args: map[string]any{"isRevision": true}, want: []string{"Pick Postgres after all"}},
+		{name: "no revisions", args: map[string]any{"isRevision": false, "toThought": 2}, want: []string{"Collect the requirements", "Pick a database"}},
+		{name: "contains ignores case", args: map[string]any{"contains": "PICK"}, want: []string{"Pick a database", "Pick Postgres after all"}},
+		{name: "pattern", args: map[string]any{"pattern": `^(Try|Write) `}, want: []string{"Try a key-value store", "Write the schema"}},
+		{name: "limit keeps the latest", args: map[string]any{"limit": float64(2)}, want: []string{"Pick Postgres after all", "Write the schema"}},
+		{name: "no match", args: map[string]any{"contains": "mongo"}, want: nil},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			q, err := parseThoughtQuery(tc.args)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			var got []string
+			for _, thought := range q.Select(history) {
+				got = append(got, thought.Thought)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("Selected %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestParseThoughtQueryErrors(t *testing.T) {
+	_, err := parseThoughtQuery(map[string]any{
+		"fromThought": "2",
+		"toThought":   0,
+		"mainLine":    true,
+		"branchId":    "kv",
+		"pattern":     "(",
+	})
+
+	var inputErr *InputError
+	if !errors.As(err, &inputErr) {
+		t.Fatalf("Expected an InputError, got %v", err)
+	}
+	var rejected []string
+	for _, f := range inputErr.Fields {
+		rejected = append(rejected, f.Field+":"+f.Rule)
+	}
+	want := []string{"fromThought:type", "toThought:min", "mainLine:conflict", "pattern:pattern"}
+	if !reflect.DeepEqual(rejected, want) {
+		t.Errorf("Rejected %v, want %v", rejected, want)
+	}
+
+	if _, err := parseThoughtQuery(map[string]any{"fromThought": 3, "toThought": 2}); err == nil || !strings.Contains(err.Error(), "toThought 2 is below fromThought 3") {
+		t.Errorf("Expected an inverted range to be rejected, got %v", err)
+	}
+}
+
+func TestGetThoughtsTool(t *testing.T) {
+	store := newQueryStore(t)
+	handler := NewGetThoughtsTool(store, Options{Format: "compact"}).Callback
+
+	result := handler(map[string]any{"branchId": "kv"})
+	if result.IsError != nil && *result.IsError {
+		t.Fatalf("Expected no error, got %s", resultText(result))
+	}
+	want := "Session design: 1 of 5 thoughts match.\n\n" + (compactRenderer{}).Render(&store.History("design")[2])
+	if text := resultText(result); text != want {
+		t.Errorf("Expected text %q, got %q", want, text)
+	}
+	if result.Meta["sessionId"] != "design" || result.Meta["matched"] != 1 || result.Meta["thoughtHistoryLength"] != 5 {
+		t.Errorf("Unexpected meta %v", result.Meta)
+	}
+
+	result = handler(map[string]any{"sessionId": "design", "toThought": 1, "format": "markdown"})
+	if text := resultText(result); !strings.Contains(text, "### 💭 Thought 1/4") {
+		t.Errorf("Expected the markdown renderer to be used, got %q", text)
+	}
+
+	for name, args := range map[string]map[string]any{
+		"unknown session": {"sessionId": "nope"},
+		"unknown format":  {"format": "html"},
+		"invalid filter":  {"limit": -1},
+	} {
+		t.Run(name, func(t *testing.T) {
+			if result := handler(args); result.IsError == nil || !*result.IsError {
+				t.Errorf("Expected an error, got %s", resultText(result))
+			}
+		})
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// ThoughtRenderer turns an accepted thought into the text of a tool response.
+type ThoughtRenderer interface {
+	Render(data *ThoughtData) string
+}
+
+// renderFormats lists the names of the renderers, the first one being the
+// default.
+var renderFormats = []string{"emoji", "plain", "compact", "markdown", "json"}
+
+var renderers = map[string]ThoughtRenderer{
+	"emoji":    emojiRenderer{},
+	"plain":    plainRenderer{},
+	"compact":  compactRenderer{},
+	"markdown": markdownRenderer{},
+	"json":     jsonRenderer{},
+}
+
+// rendererFor returns the renderer called format, or the default renderer if
+// format is empty.
+func rendererFor(format string) (ThoughtRenderer, error) {
+	if format == "" {
+		format = renderFormats[0]
+	}
+	r, ok := renderers[format]
+	if !ok {
+		return nil, fmt.Errorf("unknown format %q, expected one of %s", format, strings.Join(renderFormats, ", "))
+	}
+	return r, nil
+}
+
+// emojiRenderer is the original, emoji-decorated style.
+type emojiRenderer struct{}
+
+func (emojiRenderer) Render(data *ThoughtData) string {
+	return formatThought(data)
+}
+
+// plainRenderer has the layout of the emoji style in plain ASCII.
+type plainRenderer struct{}
+
+func (plainRenderer) Render(data *ThoughtData) string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "Thought %d/%d\n", data.ThoughtNumber, data.TotalThoughts)
+	for _, marker := range thoughtMarkers(data) {
+		fmt.Fprintf(&b, "- %s\n", marker.text)
+	}
+
+	fmt.Fprintf(&b, "\n%s\n", data.Thought)
+
+	status, nextNeeded := thoughtStatus(data)
+	fmt.Fprintf(&b, "\n%s\n", status.text)
+	fmt.Fprintf(&b, "\nStatus: Thought %d/%d | Next needed: %v\n", data.ThoughtNumber, data.TotalThoughts, nextNeeded)
+
+	return b.String()
+}
+
+// compactRenderer puts a thought on a single line, for logs and for callers
+// that count tokens.
+type compactRenderer struct{}
+
+func (compactRenderer) Render(data *ThoughtData) string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "#%d/%d", data.ThoughtNumber, data.TotalThoughts)
+	if data.ExtendedBy > 0 {
+		fmt.Fprintf(&b, " +%d", data.ExtendedBy)
+	}
+	if data.RevisesThought != nil {
+		fmt.Fprintf(&b, " rev:%d", *data.RevisesThought)
+	}
+	if data.BranchID != "" {
+		fmt.Fprintf(&b, " branch:%s", data.BranchID)
+		if data.BranchFromThought != nil {
+			fmt.Fprintf(&b, "@%d", *data.BranchFromThought)
+		}
+	}
+	if data.MergeBranch != "" {
+		fmt.Fprintf(&b, " merge:%s", data.MergeBranch)
+	}
+	if data.BranchState != "" {
+		fmt.Fprintf(&b, " state:%s", data.BranchState)
+	}
+
+	next := "done"
+	if _, nextNeeded := thoughtStatus(data); nextNeeded {
+		next = "more"
+	}
+	fmt.Fprintf(&b, " | %s | %s\n", strings.Join(strings.Fields(data.Thought), " "), next)
+
+	return b.String()
+}
+
+// markdownRenderer renders a thought as a Markdown section, as used by the
+// Markdown export.
+type markdownRenderer struct{}
+
+func (markdownRenderer) Render(data *ThoughtData) string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "### 💭 Thought %d/%d\n\n", data.ThoughtNumber, data.TotalThoughts)
+	if markers := thoughtMarkers(data); len(markers) > 0 {
+		lines := make([]string, 0, len(markers))
+		for _, marker := range markers {
+			lines = append(lines, marker.emoji+" "+marker.text)
+		}
+		// Two trailing spaces keep the markers on lines of their own.
+		fmt.Fprintf(&b, "%s\n\n", strings.Join(lines, "  \n"))
+	}
+	fmt.Fprintf(&b, "%s\n\n", data.Thought)
+
+	status, _ := thoughtStatus(data)
+	fmt.Fprintf(&b, "*%s %s*\n", status.emoji, status.text)
+
+	return b.String()
+}
+
+// jsonRenderer renders the thought as recorded, as a JSON object.
+type jsonRenderer struct{}
+
+func (jsonRenderer) Render(data *ThoughtData) string {
+	out, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Sprintf(`{"error":%q}`, err.Error())
+	}
+	return string(out) + "\n"
+}
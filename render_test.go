@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestRenderers(t *testing.T) {
+	data := &ThoughtData{
+		Thought:           "Reconsider the cache\nlayer",
+		ThoughtNumber:     4,
+		TotalThoughts:     5,
+		IsRevision:        ptr(true),
+		RevisesThought:    ptr(2),
+		BranchFromThought: ptr(3),
+		BranchID:          "cache",
+		NextThoughtNeeded: ptr(true),
+		ExtendedBy:        1,
+	}
+
+	testCases := []struct {
+		format string
+		want   []string
+	}{
+		{format: "emoji", want: []string{"💭 Thought 4/5", "📈 Estimate raised to 5 thoughts (+1)", "🔄 Revising thought 2", "🌿 Branching from thought 3 (cache)", "→ More thinking needed"}},
+		{format: "plain", want: []string{"Thought 4/5\n", "- Revising thought 2\n", "- Branching from thought 3 (cache)\n", "\nMore thinking needed\n", "Status: Thought 4/5 | Next needed: true"}},
+		{format: "compact", want: []string{"#4/5 +1 rev:2 branch:cache@3 | Reconsider the cache layer | more\n"}},
+		{format: "markdown", want: []string{"### 💭 Thought 4/5\n", "🔄 Revising thought 2  \n🌿", "*→ More thinking needed*"}},
+		{format: "json", want: []string{`"revisesThought":2`, `"branchId":"cache"`, `"extendedBy":1`}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.format, func(t *testing.T) {
+			r, err := rendererFor(tc.format)
+			if err != nil {
+				t.Fatalf("Expected renderer, got %v", err)
+			}
+			text := r.Render(data)
+			for _, want := range tc.want {
+				if !strings.Contains(text, want) {
+					t.Errorf("Expected output to contain %q, got:\n%s", want, text)
+				}
+			}
+		})
+	}
+
+	t.Run("merge", func(t *testing.T) {
+		merge := &ThoughtData{Thought: "Adopt the cache", ThoughtNumber: 5, TotalThoughts: 5, MergeBranch: "cache"}
+		for format, want := range map[string]string{
+			"emoji":    "🔀 Merging branch cache",
+			"plain":    "- Merging branch cache\n",
+			"compact":  "#5/5 merge:cache | Adopt the cache | done\n",
+			"markdown": "🔀 Merging branch cache\n\n",
+			"json":     `"mergeBranch":"cache"`,
+		} {
+			if text := renderers[format].Render(merge); !strings.Contains(text, want) {
+				t.Errorf("Expected %s output to contain %q, got:\n%s", format, want, text)
+			}
+		}
+	})
+
+	t.Run("branch state", func(t *testing.T) {
+		abandon := &ThoughtData{Thought: "Drop the cache", ThoughtNumber: 5, TotalThoughts: 5, BranchID: "cache", BranchState: BranchAbandoned, BranchReason: "too complex"}
+		for format, want := range map[string]string{
+			"emoji":    "⛔ Abandoning branch cache: too complex",
+			"plain":    "- Abandoning branch cache: too complex\n",
+			"compact":  "#5/5 branch:cache state:abandoned | Drop the cache | done\n",
+			"markdown": "⛔ Abandoning branch cache: too complex\n\n",
+			"json":     `"branchState":"abandoned","branchReason":"too complex"`,
+		} {
+			if text := renderers[format].Render(abandon); !strings.Contains(text, want) {
+				t.Errorf("Expected %s output to contain %q, got:\n%s", format, want, text)
+			}
+		}
+	})
+
+	t.Run("plain is ASCII", func(t *testing.T) {
+		for _, r := range (plainRenderer{}).Render(data) {
+			if r > 127 {
+				t.Fatalf("Expected only ASCII, found %q", r)
+			}
+		}
+	})
+
+	t.Run("compact is a single line", func(t *testing.T) {
+		if text := (compactRenderer{}).Render(data); strings.Count(text, "\n") != 1 {
+			t.Errorf("Expected a single line, got %q", text)
+		}
+	})
+
+	t.Run("json decodes", func(t *testing.T) {
+		var decoded ThoughtData
+		if err := json.Unmarshal([]byte((jsonRenderer{}).Render(data)), &decoded); err != nil {
+			t.Fatalf("Failed to decode: %v", err)
+		}
+		if decoded.Thought != data.Thought || *decoded.RevisesThought != 2 {
+			t.Errorf("Expected the thought to round-trip, got %+v", decoded)
+		}
+	})
+
+	t.Run("default and unknown", func(t *testing.T) {
+		if r, err := rendererFor(""); err != nil || r != (emojiRenderer{}) {
+			t.Errorf("Expected the emoji renderer by default, got %v %v", r, err)
+		}
+		if _, err := rendererFor("html"); err == nil {
+			t.Error("Expected error for unknown format")
+		}
+	})
+}
+
+func TestSequentialThinkingToolFormat(t *testing.T) {
+	args := func(format string) map[string]any {
+		a := map[string]any{"thought": "step", "thoughtNumber": 1, "totalThoughts": 2}
+		if format != "" {
+			a["format"] = format
+		}
+		return a
+	}
+
+	t.Run("server default", func(t *testing.T) {
+		handler := NewSequentialThinkingTool(NewThoughtStore(), Options{Format: "compact"}).Callback
+		if text := resultText(handler(args(""))); text != "#1/2 | step | more\n" {
+			t.Errorf("Expected compact output, got %q", text)
+		}
+	})
+
+	t.Run("per call", func(t *testing.T) {
+		handler := NewSequentialThinkingTool(NewThoughtStore(), Options{Format: "compact"}).Callback
+		if text := resultText(handler(args("plain"))); !strings.HasPrefix(text, "Thought 1/2\n") {
+			t.Errorf("Expected plain output, got %q", text)
+		}
+	})
+
+	t.Run("unknown format", func(t *testing.T) {
+		store := NewThoughtStore()
+		result := NewSequentialThinkingTool(store, Options{}).Callback(args("html"))
+		if result.IsError == nil || !*result.IsError || !strings.Contains(resultText(result), "unknown format") {
+			t.Errorf("Expected unknown format error, got %s", resultText(result))
+		}
+		if len(store.History(defaultSessionID)) != 0 {
+			t.Error("Expected rejected thought not to be recorded")
+		}
+	})
+}
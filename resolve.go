@@ -0,0 +1,151 @@
+package main
+
+import "fmt"
+
+// ResolvedThought is a step of an effective chain: a thought with the content
+// of its latest revision.
+type ResolvedThought struct {
+	ThoughtData
+	// Original is the text the thought was first recorded with, set if it
+	// was revised.
+	Original string `json:"original,omitempty"`
+	// RevisedBy lists the revisions applied to the thought, in order.
+	RevisedBy []ThoughtRef `json:"revisedBy,omitempty"`
+}
+
+// EffectiveChain is a line of thought with its revisions applied: revised
+// thoughts show their latest content in place, and the revisions are not
+// steps of their own.
+type EffectiveChain struct {
+	// BranchID is the branch the chain ends on, empty for the main line.
+	BranchID string            `json:"branchId,omitempty"`
+	Thoughts []ResolvedThought `json:"thoughts"`
+}
+
+// RevisionIssue is a revision that could not be applied cleanly.
+type RevisionIssue struct {
+	// Kind is conflict for a thought revised directly more than once, and
+	// missing for a revision of a thought that is not on its line.
+	Kind string `json:"kind"`
+	// Thoughts are the thoughts involved, the offending revision last.
+	Thoughts []ThoughtRef `json:"thoughts"`
+	Message  string       `json:"message"`
+}
+
+// Resolution holds the effective chain of every line of thought of a session.
+type Resolution struct {
+	// Chains holds the main line first, then the branches in the order
+	// they were created.
+	Chains []EffectiveChain `json:"chains"`
+	// Issues lists each problem once, even when it affects several chains.
+	Issues []RevisionIssue `json:"issues"`
+}
+
+func (r ThoughtRef) String() string {
+	if r.BranchID == "" {
+		return fmt.Sprint(r.ThoughtNumber)
+	}
+	return fmt.Sprintf("%d (branch %s)", r.ThoughtNumber, r.BranchID)
+}
+
+func refOf(t *ThoughtData) ThoughtRef {
+	return ThoughtRef{ThoughtNumber: t.ThoughtNumber, BranchID: t.BranchID}
+}
+
+// ResolveHistory resolves the effective chain of the main line and of each
+// branch of a session history. The chain of a branch includes the main line
+// up to where the branch diverged.
+func ResolveHistory(history []ThoughtData) *Resolution {
+	res := &Resolution{Chains: []EffectiveChain{}, Issues: []RevisionIssue{}}
+	if len(history) == 0 {
+		return res
+	}
+
+	// The latest thought of each line decides what the line holds.
+	last := map[string]int{}
+	order := []string{""}
+	for i, t := range history {
+		if _, ok := last[t.BranchID]; !ok && t.BranchID != "" {
+			order = append(order, t.BranchID)
+		}
+		last[t.BranchID] = i
+	}
+
+	g := NewThoughtGraph(history)
+	reported := map[string]bool{}
+	for _, id := range order {
+		end, ok := last[id]
+		if !ok {
+			continue
+		}
+		chain, issues := resolveLine(history, g.Lineage(end))
+		chain.BranchID = id
+		res.Chains = append(res.Chains, chain)
+
+		for _, issue := range issues {
+			if !reported[issue.Message] {
+				reported[issue.Message] = true
+				res.Issues = append(res.Issues, issue)
+			}
+		}
+	}
+
+	return res
+}
+
+// resolveLine applies the revisions of a line of thought, given as positions
+// in history, in the order they were recorded. A revision replaces the
+// content of the thought it revises, or of the thought that revision was
+// applied to when it revises a revision. Revisions that cannot be applied are
+// reported and stay steps of their own.
+func resolveLine(history []ThoughtData, line []int) (EffectiveChain, []RevisionIssue) {
+	chain := EffectiveChain{Thoughts: []ResolvedThought{}}
+	var issues []RevisionIssue
+
+	// slots maps thought numbers to the step holding their content, and refs
+	// to the thoughts themselves.
+	slots := map[int]int{}
+	refs := map[int]ThoughtRef{}
+	// revisedBy maps thought numbers to the latest revision that targeted
+	// them directly.
+	revisedBy := map[int]ThoughtRef{}
+	for _, i := range line {
+		t := history[i]
+		ref := refOf(&t)
+		refs[t.ThoughtNumber] = ref
+
+		if t.RevisesThought != nil {
+			target := *t.RevisesThought
+			if slot, ok := slots[target]; ok {
+				if previous, ok := revisedBy[target]; ok {
+					issues = append(issues, RevisionIssue{
+						Kind:     "conflict",
+						Thoughts: []ThoughtRef{refs[target], previous, ref},
+						Message:  fmt.Sprintf("thought %d was revised by thought %s and again by thought %s, which wins", target, previous, ref),
+					})
+				}
+				revisedBy[target] = ref
+
+				step := &chain.Thoughts[slot]
+				if len(step.RevisedBy) == 0 {
+					step.Original = step.Thought
+				}
+				step.Thought = t.Thought
+				step.RevisedBy = append(step.RevisedBy, ref)
+				slots[t.ThoughtNumber] = slot
+				continue
+			}
+
+			issues = append(issues, RevisionIssue{
+				Kind:     "missing",
+				Thoughts: []ThoughtRef{ref},
+				Message:  fmt.Sprintf("thought %s revises thought %d, which is not on its line of thought", ref, target),
+			})
+		}
+
+		slots[t.ThoughtNumber] = len(chain.Thoughts)
+		chain.Thoughts = append(chain.Thoughts, ResolvedThought{ThoughtData: t})
+	}
+
+	return chain, issues
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/strowk/foxy-contexts/pkg/mcp"
+)
+
+func resolvedTexts(chain []ResolvedThought) []string {
+	texts := make([]string, len(chain))
+	for i, step := range chain {
+		texts[i] = step.Thought
+	}
+	return texts
+}
+
+func TestResolveHistory(t *testing.T) {
+	// 1 -> 2 -> 3 -> 4 (revises 2) -> 5 (revises 4), and branch alt from 3
+	// with 4 (revises 3).
+	history := []ThoughtData{
+		{Thought: "Frame", ThoughtNumber: 1, TotalThoughts: 5},
+		{Thought: "Guess", ThoughtNumber: 2, TotalThoughts: 5},
+		{Thought: "Build on the guess", ThoughtNumber: 3, TotalThoughts: 5},
+		{Thought: "Better guess", ThoughtNumber: 4, TotalThoughts: 5, IsRevision: ptr(true), RevisesThought: ptr(2)},
+		{Thought: "Alternative step", ThoughtNumber: 4, TotalThoughts: 5, BranchFromThought: ptr(3), BranchID: "alt", IsRevision: ptr(true), RevisesThought: ptr(3)},
+		{Thought: "Best guess", ThoughtNumber: 5, TotalThoughts: 5, IsRevision: ptr(true), RevisesThought: ptr(4)},
+	}
+
+	res := ResolveHistory(history)
+	if len(res.Chains) != 2 {
+		t.Fatalf("Expected 2 chains, got %d", len(res.Chains))
+	}
+
+	main := res.Chains[0]
+	if main.BranchID != "" {
+		t.Errorf("Expected the main line first, got %q", main.BranchID)
+	}
+	if got, want := resolvedTexts(main.Thoughts), []string{"Frame", "Best guess", "Build on the guess"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Main line = %q, want %q", got, want)
+	}
+	step := main.Thoughts[1]
+	if step.ThoughtNumber != 2 || step.Original != "Guess" {
+		t.Errorf("Expected thought 2 revised in place, got %+v", step)
+	}
+	if want := []ThoughtRef{{ThoughtNumber: 4}, {ThoughtNumber: 5}}; !reflect.DeepEqual(step.RevisedBy, want) {
+		t.Errorf("RevisedBy = %v, want %v", step.RevisedBy, want)
+	}
+
+	// The branch only sees the main line up to where it diverged, so its
+	// revision of thought 3 is applied but not those of thought 2.
+	alt := res.Chains[1]
+	if got, want := resolvedTexts(alt.Thoughts), []string{"Frame", "Guess", "Alternative step"}; alt.BranchID != "alt" || !reflect.DeepEqual(got, want) {
+		t.Errorf("Branch %q = %q, want %q", alt.BranchID, got, want)
+	}
+
+	if len(res.Issues) != 0 {
+		t.Errorf("Expected no issues, got %v", res.Issues)
+	}
+
+	t.Run("empty history", func(t *testing.T) {
+		res := ResolveHistory(nil)
+		if res.Chains == nil || res.Issues == nil || len(res.Chains) != 0 {
+			t.Errorf("Expected an empty resolution with empty lists, got %+v", res)
+		}
+	})
+}
+
+func TestResolveHistoryIssues(t *testing.T) {
+	testCases := []struct {
+		name    string
+		history []ThoughtData
+		chain   []string
+		kind    string
+		message string
+	}{
+		{
+			name: "conflicting revisions",
+			history: []ThoughtData{
+				{Thought: "Frame", ThoughtNumber: 1, TotalThoughts: 3},
+				{Thought: "Reframe", ThoughtNumber: 2, TotalThoughts: 3, IsRevision: ptr(true), RevisesThought: ptr(1)},
+				{Thought: "Reframe again", ThoughtNumber: 3, TotalThoughts: 3, IsRevision: ptr(true), RevisesThought: ptr(1)},
+			},
+			chain:   []string{"Reframe again"},
+			kind:    "conflict",
+			message: "thought 1 was revised by thought 2 and again by thought 3, which wins",
+		},
+		{
+			name: "conflicting revisions of a revision",
+			history: []ThoughtData{
+				{Thought: "Frame", ThoughtNumber: 1, TotalThoughts: 4},
+				{Thought: "Reframe", ThoughtNumber: 2, TotalThoughts: 4, IsRevision: ptr(true), RevisesThought: ptr(1)},
+				{Thought: "Refine the reframe", ThoughtNumber: 3, TotalThoughts: 4, IsRevision: ptr(true), RevisesThought: ptr(2)},
+				{Thought: "Refine it differently", ThoughtNumber: 4, TotalThoughts: 4, IsRevision: ptr(true), RevisesThought: ptr(2)},
+			},
+			chain:   []string{"Refine it differently"},
+			kind:    "conflict",
+			message: "thought 2 was revised by thought 3 and again by thought 4, which wins",
+		},
+		{
+			name: "missing target",
+			history: []ThoughtData{
+				{Thought: "Frame", ThoughtNumber: 1, TotalThoughts: 3},
+				{Thought: "Revise the unknown", ThoughtNumber: 3, TotalThoughts: 3, IsRevision: ptr(true), RevisesThought: ptr(2)},
+			},
+			chain:   []string{"Frame", "Revise the unknown"},
+			kind:    "missing",
+			message: "thought 3 revises thought 2, which is not on its line of thought",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			res := ResolveHistory(tc.history)
+			if got := resolvedTexts(res.Chains[0].Thoughts); !reflect.DeepEqual(got, tc.chain) {
+				t.Errorf("Chain = %q, want %q", got, tc.chain)
+			}
+			if len(res.Issues) != 1 {
+				t.Fatalf("Expected 1 issue, got %v", res.Issues)
+			}
+			if issue := res.Issues[0]; issue.Kind != tc.kind || issue.Message != tc.message {
+				t.Errorf("Expected %s issue %q, got %s issue %q", tc.kind, tc.message, issue.Kind, issue.Message)
+			}
+		})
+	}
+
+	t.Run("sequential revisions", func(t *testing.T) {
+		// 3 revises 2, then 4 revises 3: each revision refines the one
+		// before, so nothing conflicts.
+		history := []ThoughtData{
+			{Thought: "Frame", ThoughtNumber: 1, TotalThoughts: 4},
+			{Thought: "Guess", ThoughtNumber: 2, TotalThoughts: 4},
+			{Thought: "Better guess", ThoughtNumber: 3, TotalThoughts: 4, IsRevision: ptr(true), RevisesThought: ptr(2)},
+			{Thought: "Best guess", ThoughtNumber: 4, TotalThoughts: 4, IsRevision: ptr(true), RevisesThought: ptr(3)},
+		}
+		res := ResolveHistory(history)
+		if got, want := resolvedTexts(res.Chains[0].Thoughts), []string{"Frame", "Best guess"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("Chain = %q, want %q", got, want)
+		}
+		if len(res.Issues) != 0 {
+			t.Errorf("Expected no issues, got %v", res.Issues)
+		}
+	})
+
+	t.Run("reported once across chains", func(t *testing.T) {
+		history := []ThoughtData{
+			{Thought: "Frame", ThoughtNumber: 1, TotalThoughts: 4},
+			{Thought: "Reframe", ThoughtNumber: 2, TotalThoughts: 4, IsRevision: ptr(true), RevisesThought: ptr(1)},
+			{Thought: "Reframe again", ThoughtNumber: 3, TotalThoughts: 4, IsRevision: ptr(true), RevisesThought: ptr(1)},
+			{Thought: "Alternative", ThoughtNumber: 4, TotalThoughts: 4, BranchFromThought: ptr(3), BranchID: "alt"},
+		}
+		if res := ResolveHistory(history); len(res.Chains) != 2 || len(res.Issues) != 1 {
+			t.Errorf("Expected 2 chains sharing 1 issue, got %+v", res)
+		}
+	})
+}
+
+func TestFinalAndChainResources(t *testing.T) {
+	store := newCompactStore(t)
+
+	read := func(uri string, doc any) string {
+		t.Helper()
+		result, err := readThoughtResource(store, uri)
+		if err != nil {
+			t.Fatalf("Failed to read %s: %v", uri, err)
+		}
+		if err := json.Unmarshal([]byte(result.Contents[0].(mcp.TextResourceContents).Text), doc); err != nil {
+			t.Fatalf("Failed to decode %s: %v", uri, err)
+		}
+		return result.Contents[1].(mcp.TextResourceContents).Text
+	}
+
+	var final finalResource
+	markdown := read("thoughts://session/current/final", &final)
+	if !final.Concluded || final.Answer.Thought != "Conclusion" || len(final.Chain) != 3 {
+		t.Errorf("Unexpected final answer %+v", final)
+	}
+	if revised := final.Chain[1]; revised.Thought != "Second attempt" || revised.Original != "First attempt" {
+		t.Errorf("Expected thought 2 revised in place, got %+v", revised)
+	}
+	if !strings.HasPrefix(markdown, "# Final answer of session s\n\nConclusion\n") || !strings.Contains(markdown, "2. Second attempt _(thought 2, revised by thought 3)_") {
+		t.Errorf("Unexpected markdown:\n%s", markdown)
+	}
+
+	var res Resolution
+	markdown = read("thoughts://session/s/chains", &res)
+	if len(res.Chains) != 2 || res.Chains[1].BranchID != "alt" {
+		t.Errorf("Expected the main line and branch alt, got %+v", res)
+	}
+	if !strings.Contains(markdown, "## Branch `alt`\n\n1. Reframe _(thought 1, revised by thought 2 (branch alt))_") {
+		t.Errorf("Unexpected markdown:\n%s", markdown)
+	}
+}
@@ -0,0 +1,372 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/strowk/foxy-contexts/pkg/fxctx"
+	"github.com/strowk/foxy-contexts/pkg/mcp"
+)
+
+const (
+	resourceScheme = "thoughts://session/"
+
+	// currentSessionAlias can be used in place of a session ID to refer to
+	// the session that most recently recorded a thought.
+	currentSessionAlias = "current"
+)
+
+// sessionResource is the JSON document served for a session or a branch.
+type sessionResource struct {
+	SessionID string        `json:"sessionId"`
+	Branch    *Branch       `json:"branch,omitempty"`
+	Branches  []Branch      `json:"branches,omitempty"`
+	Thoughts  []ThoughtData `json:"thoughts"`
+	// Compaction describes how Thoughts were compacted from the history,
+	// if they were.
+	Compaction *Compaction `json:"compaction,omitempty"`
+}
+
+// thoughtResource is the JSON document served for a single thought.
+type thoughtResource struct {
+	SessionID string      `json:"sessionId"`
+	Thought   ThoughtData `json:"thought"`
+}
+
+// finalResource is the JSON document served for the final answer of a
+// session.
+type finalResource struct {
+	SessionID string `json:"sessionId"`
+	// Concluded reports whether Answer needed no further thinking, or is
+	// only the latest step of unfinished thinking.
+	Concluded bool            `json:"concluded"`
+	Answer    ResolvedThought `json:"answer"`
+	// Chain is the current best chain leading to Answer, revisions
+	// applied.
+	Chain  []ResolvedThought `json:"chain"`
+	Issues []RevisionIssue   `json:"issues"`
+}
+
+// NewThoughtResourceProvider exposes the thoughts recorded in store as
+// read-only resources:
+//
+//	thoughts://session/{id}
+//	thoughts://session/{id}/log
+//	thoughts://session/{id}/final
+//	thoughts://session/{id}/chains
+//	thoughts://session/{id}/branch/{branchId}
+//	thoughts://session/{id}/branch/{branchId}/thought/{n}
+//	thoughts://session/{id}/thought/{n}
+//
+// where {id} may be "current", unless the store is shared. A session resource holds the current best
+// chain of the session, and its log every recorded thought. The final
+// resource holds the conclusion of the current best chain, and the chains
+// resource the effective chain of every branch, revisions applied. A thought
+// resource without a branch is on the main line. Every resource is returned
+// both as JSON and as Markdown.
+func NewThoughtResourceProvider(store *ThoughtStore) fxctx.ResourceProvider {
+	return fxctx.NewResourceProvider(
+		func() ([]mcp.Resource, error) {
+			return listThoughtResources(store), nil
+		},
+		func(uri string) (*mcp.ReadResourceResult, error) {
+			if !strings.HasPrefix(uri, resourceScheme) {
+				return nil, nil
+			}
+			return readThoughtResource(store, uri)
+		},
+	)
+}
+
+func listThoughtResources(store *ThoughtStore) []mcp.Resource {
+	resources := []mcp.Resource{}
+	if store.CurrentSession() != "" {
+		resources = append(resources, mcp.Resource{
+			Uri:         resourceScheme + currentSessionAlias,
+			Name:        "Current thought session",
+			Description: ptr("Current best chain of thoughts of the most recently active session"),
+			MimeType:    ptr("application/json"),
+		})
+	}
+
+	for _, id := range store.Sessions() {
+		resources = append(resources, mcp.Resource{
+			Uri:         resourceScheme + id,
+			Name:        fmt.Sprintf("Thought session %s", id),
+			Description: ptr(fmt.Sprintf("Current best chain of thoughts of session %s", id)),
+			MimeType:    ptr("application/json"),
+		}, mcp.Resource{
+			Uri:         resourceScheme + id + "/log",
+			Name:        fmt.Sprintf("Log of thought session %s", id),
+			Description: ptr(fmt.Sprintf("All thoughts recorded in session %s, including superseded ones and abandoned branches", id)),
+			MimeType:    ptr("application/json"),
+		}, mcp.Resource{
+			Uri:         resourceScheme + id + "/final",
+			Name:        fmt.Sprintf("Final answer of thought session %s", id),
+			Description: ptr(fmt.Sprintf("Conclusion of the current best chain of session %s, with the revised chain leading to it", id)),
+			MimeType:    ptr("application/json"),
+		}, mcp.Resource{
+			Uri:         resourceScheme + id + "/chains",
+			Name:        fmt.Sprintf("Effective chains of thought session %s", id),
+			Description: ptr(fmt.Sprintf("Main line and branches of session %s with their revisions applied", id)),
+			MimeType:    ptr("application/json"),
+		})
+
+		for _, branch := range store.Branches(id) {
+			resources = append(resources, mcp.Resource{
+				Uri:         fmt.Sprintf("%s%s/branch/%s", resourceScheme, id, url.PathEscape(branch.ID)),
+				Name:        fmt.Sprintf("Branch %s of session %s", branch.ID, id),
+				Description: ptr(fmt.Sprintf("Thoughts on branch %s, diverging from thought %d", branch.ID, branch.FromThought)),
+				MimeType:    ptr("application/json"),
+			})
+		}
+	}
+
+	return resources
+}
+
+func readThoughtResource(store *ThoughtStore, uri string) (*mcp.ReadResourceResult, error) {
+	parts := strings.Split(strings.TrimPrefix(uri, resourceScheme), "/")
+
+	sessionID := parts[0]
+	if sessionID == currentSessionAlias {
+		current, err := store.SessionOrCurrent("")
+		if err != nil {
+			return nil, err
+		}
+		sessionID = current
+	}
+
+	history := store.History(sessionID)
+	if len(history) == 0 {
+		return nil, fmt.Errorf("session %q has no recorded thoughts", sessionID)
+	}
+
+	switch {
+	case len(parts) == 1, len(parts) == 2 && parts[1] == "log":
+		view, err := viewSession(store, sessionID, len(parts) == 2)
+		if err != nil {
+			return nil, err
+		}
+		doc := sessionResource{
+			SessionID:  sessionID,
+			Branches:   view.Branches,
+			Thoughts:   view.Thoughts,
+			Compaction: view.Compaction,
+		}
+		title := fmt.Sprintf("Log of session %s", sessionID)
+		if view.Compaction != nil {
+			title = fmt.Sprintf("Session %s: %s", sessionID, view.Compaction.Summary())
+		}
+		return thoughtResourceResult(uri, doc, markdownSession(title, view.Thoughts))
+
+	case len(parts) == 2 && parts[1] == "final":
+		c := CompactHistory(history)
+		doc := finalResource{
+			SessionID: sessionID,
+			Concluded: c.Concluded,
+			Answer:    c.Chain[len(c.Chain)-1],
+			Chain:     c.Chain,
+			Issues:    c.Issues,
+		}
+		return thoughtResourceResult(uri, doc, markdownFinal(&doc))
+
+	case len(parts) == 2 && parts[1] == "chains":
+		res := ResolveHistory(history)
+		return thoughtResourceResult(uri, res, markdownChains(sessionID, res))
+
+	case len(parts) == 3 && parts[1] == "branch",
+		len(parts) == 5 && parts[1] == "branch" && parts[3] == "thought":
+		// Branch IDs are free-form, so they are escaped in URIs.
+		branchID, err := url.PathUnescape(parts[2])
+		if err != nil {
+			return nil, fmt.Errorf("invalid branch %q: %v", parts[2], err)
+		}
+		for _, branch := range store.Branches(sessionID) {
+			if branch.ID != branchID {
+				continue
+			}
+			if len(parts) == 5 {
+				return thoughtResourceFor(uri, sessionID, history, branch.ID, parts[4])
+			}
+			thoughts := branchThoughts(history, branch.ID)
+			doc := sessionResource{
+				SessionID: sessionID,
+				Branch:    &branch,
+				Thoughts:  thoughts,
+			}
+			title := fmt.Sprintf("Branch %s of session %s (from thought %d)", branch.ID, sessionID, branch.FromThought)
+			return thoughtResourceResult(uri, doc, markdownSession(title, thoughts))
+		}
+		return nil, fmt.Errorf("session %q has no branch %q", sessionID, branchID)
+
+	case len(parts) == 3 && parts[1] == "thought":
+		return thoughtResourceFor(uri, sessionID, history, "", parts[2])
+	}
+
+	return nil, fmt.Errorf("unknown thought resource %q", uri)
+}
+
+// thoughtResourceFor serves thought number n of the main line, or of branch
+// branchID if set. Branches number their thoughts on from where they
+// diverged, so the same number can be on several lines of thought.
+func thoughtResourceFor(uri, sessionID string, history []ThoughtData, branchID, n string) (*mcp.ReadResourceResult, error) {
+	number, err := strconv.Atoi(n)
+	if err != nil {
+		return nil, fmt.Errorf("invalid thought number %q", n)
+	}
+	for i := len(history) - 1; i >= 0; i-- {
+		if history[i].BranchID == branchID && history[i].ThoughtNumber == number {
+			doc := thoughtResource{SessionID: sessionID, Thought: history[i]}
+			return thoughtResourceResult(uri, doc, markdownThought(&history[i]))
+		}
+	}
+	if branchID != "" {
+		return nil, fmt.Errorf("branch %q of session %q has no thought %d", branchID, sessionID, number)
+	}
+	return nil, fmt.Errorf("session %q has no thought %d on its main line", sessionID, number)
+}
+
+func branchThoughts(history []ThoughtData, branchID string) []ThoughtData {
+	var thoughts []ThoughtData
+	for _, t := range history {
+		if t.BranchID == branchID {
+			thoughts = append(thoughts, t)
+		}
+	}
+	return thoughts
+}
+
+func thoughtResourceResult(uri string, doc any, markdown string) (*mcp.ReadResourceResult, error) {
+	data, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode resource: %v", err)
+	}
+
+	return &mcp.ReadResourceResult{
+		Contents: []any{
+			mcp.TextResourceContents{
+				Uri:      uri,
+				MimeType: ptr("application/json"),
+				Text:     string(data),
+			},
+			mcp.TextResourceContents{
+				Uri:      uri,
+				MimeType: ptr("text/markdown"),
+				Text:     markdown,
+			},
+		},
+	}, nil
+}
+
+func markdownSession(title string, thoughts []ThoughtData) string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "# %s\n", title)
+	for i := range thoughts {
+		b.WriteString("\n")
+		b.WriteString(markdownThought(&thoughts[i]))
+	}
+
+	return b.String()
+}
+
+func markdownThought(data *ThoughtData) string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "## Thought %d/%d\n", data.ThoughtNumber, data.TotalThoughts)
+
+	if data.IsRevision != nil && *data.IsRevision && data.RevisesThought != nil {
+		fmt.Fprintf(&b, "- Revises thought %d\n", *data.RevisesThought)
+	}
+	if data.BranchFromThought != nil {
+		fmt.Fprintf(&b, "- Branches from thought %d", *data.BranchFromThought)
+		if data.BranchID != "" {
+			fmt.Fprintf(&b, " (`%s`)", data.BranchID)
+		}
+		b.WriteString("\n")
+	} else if data.BranchID != "" {
+		fmt.Fprintf(&b, "- On branch `%s`\n", data.BranchID)
+	}
+	if data.MergeBranch != "" {
+		fmt.Fprintf(&b, "- Merges branch `%s`\n", data.MergeBranch)
+	}
+	if marker, ok := branchStateMarker(data); ok {
+		fmt.Fprintf(&b, "- %s\n", marker.text)
+	}
+	if data.ExtendedBy > 0 {
+		fmt.Fprintf(&b, "- Estimate raised by %d\n", data.ExtendedBy)
+	}
+
+	fmt.Fprintf(&b, "\n%s\n", data.Thought)
+
+	return b.String()
+}
+
+func markdownFinal(doc *finalResource) string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "# Final answer of session %s\n\n%s\n", doc.SessionID, doc.Answer.Thought)
+	if !doc.Concluded {
+		b.WriteString("\nThinking has not concluded; this is its latest step.\n")
+	}
+
+	b.WriteString("\n## Reasoning\n\n")
+	b.WriteString(markdownSteps(doc.Chain))
+	b.WriteString(markdownIssues(doc.Issues))
+
+	return b.String()
+}
+
+func markdownChains(sessionID string, res *Resolution) string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "# Effective chains of session %s\n", sessionID)
+	for _, chain := range res.Chains {
+		if chain.BranchID == "" {
+			b.WriteString("\n## Main line\n\n")
+		} else {
+			fmt.Fprintf(&b, "\n## Branch `%s`\n\n", chain.BranchID)
+		}
+		b.WriteString(markdownSteps(chain.Thoughts))
+	}
+	b.WriteString(markdownIssues(res.Issues))
+
+	return b.String()
+}
+
+// markdownSteps renders an effective chain as a numbered list, noting the
+// revisions applied to each step.
+func markdownSteps(chain []ResolvedThought) string {
+	var b strings.Builder
+
+	for i, step := range chain {
+		fmt.Fprintf(&b, "%d. %s", i+1, step.Thought)
+		if n := len(step.RevisedBy); n > 0 {
+			fmt.Fprintf(&b, " _(thought %s, revised by thought %s)_", refOf(&step.ThoughtData), step.RevisedBy[n-1])
+		}
+		b.WriteString("\n")
+	}
+
+	return b.String()
+}
+
+// markdownIssues renders revision issues as a section, or nothing if there
+// are none.
+func markdownIssues(issues []RevisionIssue) string {
+	if len(issues) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+
+	b.WriteString("\n## Revision issues\n\n")
+	for _, issue := range issues {
+		fmt.Fprintf(&b, "- %s: %s\n", issue.Kind, issue.Message)
+	}
+
+	return b.String()
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/strowk/foxy-contexts/pkg/mcp"
+)
+
+func newResourceTestStore(t *testing.T) *ThoughtStore {
+	t.Helper()
+
+	store := NewThoughtStore()
+	thoughts := []ThoughtData{
+		{Thought: "Frame the problem", ThoughtNumber: 1, TotalThoughts: 3},
+		{Thought: "Try the obvious fix", ThoughtNumber: 2, TotalThoughts: 3},
+		{Thought: "Try something else", ThoughtNumber: 3, TotalThoughts: 3, BranchFromThought: ptr(1), BranchID: "alt"},
+	}
+	for _, data := range thoughts {
+		if _, err := store.Append(defaultSessionID, data); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	}
+	return store
+}
+
+func TestThoughtResourceProvider(t *testing.T) {
+	t.Run("lists current session, sessions and branches", func(t *testing.T) {
+		provider := NewThoughtResourceProvider(newResourceTestStore(t))
+
+		resources, err := provider.GetResources()
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		uris := map[string]bool{}
+		for _, r := range resources {
+			uris[r.Uri] = true
+		}
+		for _, uri := range []string{
+			"thoughts://session/current",
+			"thoughts://session/default",
+			"thoughts://session/default/log",
+			"thoughts://session/default/branch/alt",
+		} {
+			if !uris[uri] {
+				t.Errorf("Expected resource %s to be listed, got %v", uri, uris)
+			}
+		}
+	})
+
+	t.Run("reads the log of the current session as JSON and Markdown", func(t *testing.T) {
+		provider := NewThoughtResourceProvider(newResourceTestStore(t))
+
+		result, err := provider.ReadResource("thoughts://session/current/log")
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if len(result.Contents) != 2 {
+			t.Fatalf("Expected JSON and Markdown contents, got %d", len(result.Contents))
+		}
+
+		jsonContent := result.Contents[0].(mcp.TextResourceContents)
+		var doc sessionResource
+		if err := json.Unmarshal([]byte(jsonContent.Text), &doc); err != nil {
+			t.Fatalf("Expected valid JSON, got %v", err)
+		}
+		if doc.SessionID != defaultSessionID || len(doc.Thoughts) != 3 || len(doc.Branches) != 1 {
+			t.Errorf("Unexpected session document: %+v", doc)
+		}
+
+		markdown := result.Contents[1].(mcp.TextResourceContents)
+		if markdown.MimeType == nil || *markdown.MimeType != "text/markdown" {
+			t.Errorf("Expected text/markdown contents, got %v", markdown.MimeType)
+		}
+		if !strings.Contains(markdown.Text, "## Thought 2/3") || !strings.Contains(markdown.Text, "Try the obvious fix") {
+			t.Errorf("Expected thoughts in Markdown, got: %s", markdown.Text)
+		}
+	})
+
+	t.Run("reads a branch", func(t *testing.T) {
+		provider := NewThoughtResourceProvider(newResourceTestStore(t))
+
+		result, err := provider.ReadResource("thoughts://session/default/branch/alt")
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		var doc sessionResource
+		if err := json.Unmarshal([]byte(result.Contents[0].(mcp.TextResourceContents).Text), &doc); err != nil {
+			t.Fatalf("Expected valid JSON, got %v", err)
+		}
+		if doc.Branch == nil || doc.Branch.FromThought != 1 {
+			t.Errorf("Expected branch from thought 1, got %+v", doc.Branch)
+		}
+		if len(doc.Thoughts) != 1 || doc.Thoughts[0].Thought != "Try something else" {
+			t.Errorf("Expected only branch thoughts, got %+v", doc.Thoughts)
+		}
+	})
+
+	t.Run("escapes branch IDs", func(t *testing.T) {
+		store := newResourceTestStore(t)
+		data := ThoughtData{Thought: "Try a feature flag", ThoughtNumber: 2, TotalThoughts: 3, BranchFromThought: ptr(1), BranchID: "feature/x y"}
+		if _, err := store.Append(defaultSessionID, data); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		provider := NewThoughtResourceProvider(store)
+
+		uri := "thoughts://session/default/branch/feature%2Fx%20y"
+		resources, err := provider.GetResources()
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		listed := false
+		for _, r := range resources {
+			listed = listed || r.Uri == uri
+		}
+		if !listed {
+			t.Errorf("Expected resource %s to be listed, got %v", uri, resources)
+		}
+
+		result, err := provider.ReadResource(uri)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		var doc sessionResource
+		if err := json.Unmarshal([]byte(result.Contents[0].(mcp.TextResourceContents).Text), &doc); err != nil {
+			t.Fatalf("Expected valid JSON, got %v", err)
+		}
+		if doc.Branch == nil || doc.Branch.ID != "feature/x y" || len(doc.Thoughts) != 1 {
+			t.Errorf("Expected branch feature/x y, got %+v", doc)
+		}
+	})
+
+	t.Run("reads a single thought", func(t *testing.T) {
+		provider := NewThoughtResourceProvider(newResourceTestStore(t))
+
+		result, err := provider.ReadResource("thoughts://session/default/thought/2")
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		var doc thoughtResource
+		if err := json.Unmarshal([]byte(result.Contents[0].(mcp.TextResourceContents).Text), &doc); err != nil {
+			t.Fatalf("Expected valid JSON, got %v", err)
+		}
+		if doc.Thought.ThoughtNumber != 2 {
+			t.Errorf("Expected thought 2, got %d", doc.Thought.ThoughtNumber)
+		}
+	})
+
+	t.Run("reads thoughts with the same number on the main line and a branch", func(t *testing.T) {
+		store := newResourceTestStore(t)
+		if _, err := store.Append(defaultSessionID, ThoughtData{Thought: "Verify the fix", ThoughtNumber: 3, TotalThoughts: 3}); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		provider := NewThoughtResourceProvider(store)
+
+		for uri, want := range map[string]string{
+			"thoughts://session/default/thought/3":            "Verify the fix",
+			"thoughts://session/default/branch/alt/thought/3": "Try something else",
+		} {
+			result, err := provider.ReadResource(uri)
+			if err != nil {
+				t.Fatalf("Expected no error for %s, got %v", uri, err)
+			}
+			var doc thoughtResource
+			if err := json.Unmarshal([]byte(result.Contents[0].(mcp.TextResourceContents).Text), &doc); err != nil {
+				t.Fatalf("Expected valid JSON, got %v", err)
+			}
+			if doc.Thought.Thought != want {
+				t.Errorf("Expected %q from %s, got %q", want, uri, doc.Thought.Thought)
+			}
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		provider := NewThoughtResourceProvider(newResourceTestStore(t))
+
+		for _, uri := range []string{
+			"thoughts://session/missing",
+			"thoughts://session/default/branch/missing",
+			"thoughts://session/default/branch/bad%zz",
+			"thoughts://session/default/thought/9",
+			"thoughts://session/default/thought/3",
+			"thoughts://session/default/branch/alt/thought/2",
+			"thoughts://session/default/branch/alt/thought/x",
+			"thoughts://session/default/branch/alt/log",
+			"thoughts://session/default/thought/x",
+			"thoughts://session/default/unknown",
+		} {
+			if _, err := provider.ReadResource(uri); err == nil {
+				t.Errorf("Expected error for %s", uri)
+			}
+		}
+	})
+
+	t.Run("ignores other schemes", func(t *testing.T) {
+		provider := NewThoughtResourceProvider(newResourceTestStore(t))
+
+		result, err := provider.ReadResource("file:///etc/hosts")
+		if err != nil || result != nil {
+			t.Errorf("Expected other schemes to be left alone, got %v, %v", result, err)
+		}
+	})
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/strowk/foxy-contexts/pkg/fxctx"
+	"github.com/strowk/foxy-contexts/pkg/mcp"
+)
+
+// requestedSession returns the session named in the arguments of a tool call,
+// as far as it can be told before they are validated.
+func requestedSession(args map[string]any) string {
+	if id, ok := args["sessionId"].(string); ok && id != "" {
+		return id
+	}
+	return defaultSessionID
+}
+
+func toolErrorResult(err error) *mcp.CallToolResult {
+	return &mcp.CallToolResult{
+		IsError: ptr(true),
+		Content: []any{
+			mcp.TextContent{
+				Type: "text",
+				Text: fmt.Sprintf("Error: %v", err),
+			},
+		},
+	}
+}
+
+func textResult(text string, meta map[string]any) *mcp.CallToolResult {
+	return &mcp.CallToolResult{
+		Content: []any{
+			mcp.TextContent{
+				Type: "text",
+				Text: text,
+			},
+		},
+		IsError: ptr(false),
+		Meta:    meta,
+	}
+}
+
+// NewStartSessionTool creates the tool that starts a new thought session.
+func NewStartSessionTool(store *ThoughtStore, opts Options) fxctx.Tool {
+	return fxctx.NewTool(
+		&mcp.Tool{
+			Name:        "start_session",
+			Description: ptr("Start a new, isolated thinking session. Pass the returned sessionId to sequential_thinking to keep its thoughts, branches and counters apart from other runs."),
+			InputSchema: mcp.ToolInputSchema{
+				Type: "object",
+				Properties: map[string]map[string]any{
+					"sessionId": {
+						"type":        "string",
+						"description": "ID for the new session (up to 64 letters, digits, '.', '_', ':' or '-'); a random one is assigned if omitted",
+					},
+				},
+			},
+		},
+		func(args map[string]any) *mcp.CallToolResult {
+			requested, err := stringArg(args, "sessionId")
+			if err != nil {
+				return toolErrorResult(err)
+			}
+
+			id, err := store.StartSession(requested)
+			if err != nil {
+				return toolErrorResult(err)
+			}
+			if opts.Logger != nil {
+				opts.Logger.Info("session started", "session", id)
+			}
+
+			return textResult(
+				fmt.Sprintf("Started session %s. Pass sessionId %q to sequential_thinking to record thoughts in it.", id, id),
+				map[string]any{"sessionId": id},
+			)
+		},
+	)
+}
+
+// NewListSessionsTool creates the tool that lists the thought sessions.
+func NewListSessionsTool(store *ThoughtStore) fxctx.Tool {
+	return fxctx.NewTool(
+		&mcp.Tool{
+			Name:        "list_sessions",
+			Description: ptr("List the thinking sessions with their number of thoughts and branches and whether they are complete."),
+			InputSchema: mcp.ToolInputSchema{
+				Type:       "object",
+				Properties: map[string]map[string]any{},
+			},
+		},
+		func(args map[string]any) *mcp.CallToolResult {
+			summaries := store.Summaries()
+			current := store.CurrentSession()
+
+			var b strings.Builder
+			if len(summaries) == 0 {
+				b.WriteString("No sessions.\n")
+			}
+			for _, s := range summaries {
+				fmt.Fprintf(&b, "- %s: %d thoughts, %d branches", s.ID, s.Thoughts, s.Branches)
+				if s.Thoughts > 0 {
+					state := "in progress"
+					if s.Complete {
+						state = "complete"
+					}
+					fmt.Fprintf(&b, ", at thought %d/%d, %s", s.LastThought, s.TotalThoughts, state)
+				}
+				if s.ID == current {
+					b.WriteString(" (current)")
+				}
+				b.WriteString("\n")
+			}
+
+			return textResult(b.String(), map[string]any{
+				"sessions":       summaries,
+				"currentSession": current,
+			})
+		},
+	)
+}
+
+// NewEndSessionTool creates the tool that ends a thought session and
+// discards its history.
+func NewEndSessionTool(store *ThoughtStore, opts Options) fxctx.Tool {
+	return fxctx.NewTool(
+		&mcp.Tool{
+			Name:        "end_session",
+			Description: ptr("End a thinking session and discard its thoughts and branches, including any persisted copy."),
+			InputSchema: mcp.ToolInputSchema{
+				Type: "object",
+				Properties: map[string]map[string]any{
+					"sessionId": {
+						"type":        "string",
+						"description": "ID of the session to end",
+					},
+				},
+				Required: []string{"sessionId"},
+			},
+		},
+		func(args map[string]any) *mcp.CallToolResult {
+			id, err := stringArg(args, "sessionId")
+			if err != nil {
+				return toolErrorResult(err)
+			}
+			if id == "" {
+				return toolErrorResult(fmt.Errorf("sessionId is required"))
+			}
+
+			discarded, err := store.EndSession(id)
+			if err != nil {
+				return toolErrorResult(err)
+			}
+			if opts.Logger != nil {
+				opts.Logger.Info("session ended", "session", id, "discarded", discarded)
+			}
+
+			return textResult(
+				fmt.Sprintf("Ended session %s, discarding %d thoughts.", id, discarded),
+				map[string]any{"sessionId": id, "discarded": discarded},
+			)
+		},
+	)
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/strowk/foxy-contexts/pkg/mcp"
+)
+
+func resultText(result *mcp.CallToolResult) string {
+	if len(result.Content) == 0 {
+		return ""
+	}
+	text, _ := result.Content[0].(mcp.TextContent)
+	return text.Text
+}
+
+// recordSession records thoughts in the session sessionID of a new store
+// through the sequential thinking tool, failing the test if one is rejected.
+func recordSession(t *testing.T, opts Options, sessionID string, thoughts ...map[string]any) *ThoughtStore {
+	t.Helper()
+
+	store := NewThoughtStore()
+	handler := NewSequentialThinkingTool(store, opts).Callback
+	for _, args := range thoughts {
+		args["sessionId"] = sessionID
+		if result := handler(args); result.IsError != nil && *result.IsError {
+			t.Fatalf("Expected no error, got %s", resultText(result))
+		}
+	}
+	return store
+}
+
+func TestSessionIsolation(t *testing.T) {
+	store := NewThoughtStore()
+	handler := NewSequentialThinkingTool(store, Options{}).Callback
+
+	for _, id := range []string{"alpha", "beta"} {
+		for i := 1; i <= 2; i++ {
+			result := handler(map[string]any{"thought": id, "thoughtNumber": i, "totalThoughts": 2, "sessionId": id})
+			if result.IsError != nil && *result.IsError {
+				t.Fatalf("Expected no error, got %s", resultText(result))
+			}
+			if got := result.Meta["sessionId"]; got != id {
+				t.Errorf("Expected sessionId %s in meta, got %v", id, got)
+			}
+			if histLen := result.Meta["thoughtHistoryLength"]; histLen != i {
+				t.Errorf("Expected thoughtHistoryLength = %d in session %s, got %v", i, id, histLen)
+			}
+		}
+	}
+
+	result := handler(map[string]any{"thought": "alt", "thoughtNumber": 3, "totalThoughts": 3, "branchFromThought": 1, "branchId": "b", "sessionId": "alpha"})
+	if branches := result.Meta["branches"].([]BranchStatus); len(branches) != 1 {
+		t.Errorf("Expected 1 branch in alpha, got %v", branches)
+	}
+	if branches := store.Branches("beta"); len(branches) != 0 {
+		t.Errorf("Expected no branches in beta, got %v", branches)
+	}
+
+	// Branches are not visible across sessions either.
+	result = handler(map[string]any{"thought": "cont", "thoughtNumber": 3, "totalThoughts": 3, "branchId": "b", "sessionId": "beta"})
+	if result.IsError == nil || !*result.IsError {
+		t.Error("Expected branch of another session to be unknown")
+	}
+
+	result = handler(map[string]any{"thought": "plain", "thoughtNumber": 1, "totalThoughts": 1})
+	if got := result.Meta["sessionId"]; got != defaultSessionID {
+		t.Errorf("Expected default session without sessionId, got %v", got)
+	}
+
+	for _, id := range []any{"no spaces", "../escape", strings.Repeat("x", 65), 42} {
+		result := handler(map[string]any{"thought": "bad", "thoughtNumber": 1, "totalThoughts": 1, "sessionId": id})
+		if result.IsError == nil || !*result.IsError {
+			t.Errorf("Expected sessionId %v to be rejected", id)
+		}
+	}
+}
+
+func TestSharedStore(t *testing.T) {
+	store := NewThoughtStore()
+	store.SetShared(true)
+	think := NewSequentialThinkingTool(store, Options{}).Callback
+
+	// Every client that leaves out the session ID gets a session of its own.
+	first := think(map[string]any{"thought": "one", "thoughtNumber": 1, "totalThoughts": 2})
+	second := think(map[string]any{"thought": "other", "thoughtNumber": 1, "totalThoughts": 2})
+	id, _ := first.Meta["sessionId"].(string)
+	if !sessionIDPattern.MatchString(id) || id == defaultSessionID || id == second.Meta["sessionId"] {
+		t.Fatalf("Expected a new session per first thought, got %v and %v", id, second.Meta["sessionId"])
+	}
+	if history := store.History(defaultSessionID); len(history) != 0 {
+		t.Errorf("Expected nothing in the default session, got %v", history)
+	}
+
+	result := think(map[string]any{"thought": "two", "thoughtNumber": 2, "totalThoughts": 2})
+	if result.IsError == nil || !*result.IsError || !strings.Contains(resultText(result), "sessionId is required") {
+		t.Errorf("Expected later thoughts to need a sessionId, got %s", resultText(result))
+	}
+	if result := think(map[string]any{"thought": "two", "thoughtNumber": 2, "totalThoughts": 2, "sessionId": id}); result.IsError != nil && *result.IsError {
+		t.Errorf("Expected no error, got %s", resultText(result))
+	}
+
+	// There is no current session to fall back to.
+	if current := store.CurrentSession(); current != "" {
+		t.Errorf("Expected no current session, got %q", current)
+	}
+	for name, handler := range map[string]func(map[string]any) *mcp.CallToolResult{
+		"get_thoughts":    NewGetThoughtsTool(store, Options{}).Callback,
+		"export_thoughts": NewExportThoughtsTool(store).Callback,
+		"compact_session": NewCompactSessionTool(store, Options{}).Callback,
+	} {
+		if result := handler(map[string]any{}); result.IsError == nil || !*result.IsError || !strings.Contains(resultText(result), "sessionId is required") {
+			t.Errorf("Expected %s to need a sessionId, got %s", name, resultText(result))
+		}
+		if result := handler(map[string]any{"sessionId": id}); result.IsError != nil && *result.IsError {
+			t.Errorf("Expected %s to read session %s, got %s", name, id, resultText(result))
+		}
+	}
+	if _, err := readThoughtResource(store, "thoughts://session/current"); err == nil {
+		t.Error("Expected the current session resource to be unavailable")
+	}
+	for _, r := range listThoughtResources(store) {
+		if r.Uri == resourceScheme+currentSessionAlias {
+			t.Error("Expected the current session resource not to be listed")
+		}
+	}
+}
+
+func TestSessionTools(t *testing.T) {
+	store := NewThoughtStore()
+	start := NewStartSessionTool(store, Options{}).Callback
+	list := NewListSessionsTool(store).Callback
+	end := NewEndSessionTool(store, Options{}).Callback
+	think := NewSequentialThinkingTool(store, Options{}).Callback
+
+	t.Run("start assigns an id", func(t *testing.T) {
+		result := start(map[string]any{})
+		id, _ := result.Meta["sessionId"].(string)
+		if !sessionIDPattern.MatchString(id) {
+			t.Fatalf("Expected a valid session id, got %q", id)
+		}
+		if other := start(map[string]any{}).Meta["sessionId"]; other == id {
+			t.Error("Expected a new id for every session")
+		}
+	})
+
+	t.Run("start with a name", func(t *testing.T) {
+		if result := start(map[string]any{"sessionId": "review"}); result.Meta["sessionId"] != "review" {
+			t.Fatalf("Expected session review, got %s", resultText(result))
+		}
+		if result := start(map[string]any{"sessionId": "review"}); result.IsError == nil || !*result.IsError {
+			t.Error("Expected error for an existing session")
+		}
+		if result := start(map[string]any{"sessionId": "a/b"}); result.IsError == nil || !*result.IsError {
+			t.Error("Expected error for an invalid session id")
+		}
+		if result := start(map[string]any{"sessionId": currentSessionAlias}); result.IsError == nil || !strings.Contains(resultText(result), "reserved") {
+			t.Errorf("Expected the current alias to be reserved, got %s", resultText(result))
+		}
+		if result := start(map[string]any{"sessionId": 5}); result.IsError == nil || !strings.Contains(resultText(result), "sessionId must be a string") {
+			t.Errorf("Expected a type error for a numeric session id, got %s", resultText(result))
+		}
+	})
+
+	t.Run("list", func(t *testing.T) {
+		think(map[string]any{"thought": "one", "thoughtNumber": 1, "totalThoughts": 1, "sessionId": "review"})
+
+		result := list(map[string]any{})
+		summaries := result.Meta["sessions"].([]SessionSummary)
+		if len(summaries) != 3 {
+			t.Fatalf("Expected 3 sessions, got %v", summaries)
+		}
+
+		var review SessionSummary
+		for _, s := range summaries {
+			if s.ID == "review" {
+				review = s
+			}
+		}
+		if review.Thoughts != 1 || !review.Complete || review.LastThought != 1 {
+			t.Errorf("Expected a complete review session with 1 thought, got %+v", review)
+		}
+		if text := resultText(result); !strings.Contains(text, "- review: 1 thoughts, 0 branches, at thought 1/1, complete (current)") {
+			t.Errorf("Expected review to be listed as current, got:\n%s", text)
+		}
+	})
+
+	t.Run("end", func(t *testing.T) {
+		result := end(map[string]any{"sessionId": "review"})
+		if result.IsError != nil && *result.IsError {
+			t.Fatalf("Expected no error, got %s", resultText(result))
+		}
+		if result.Meta["discarded"] != 1 {
+			t.Errorf("Expected 1 discarded thought, got %v", result.Meta["discarded"])
+		}
+		if store.CurrentSession() != defaultSessionID {
+			t.Errorf("Expected current session to fall back to default, got %s", store.CurrentSession())
+		}
+		if history := store.History("review"); len(history) != 0 {
+			t.Errorf("Expected history to be discarded, got %v", history)
+		}
+
+		if result := end(map[string]any{"sessionId": "review"}); result.IsError == nil || !*result.IsError {
+			t.Error("Expected error for an unknown session")
+		}
+		if result := end(map[string]any{}); result.IsError == nil || !*result.IsError {
+			t.Error("Expected error without sessionId")
+		}
+		if result := end(map[string]any{"sessionId": 5}); result.IsError == nil || !strings.Contains(resultText(result), "sessionId must be a string") {
+			t.Errorf("Expected a type error for a numeric session id, got %s", resultText(result))
+		}
+	})
+}
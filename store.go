@@ -0,0 +1,618 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// defaultSessionID is the session used when the caller does not name one.
+const defaultSessionID = "default"
+
+// sessionIDPattern keeps session IDs usable in resource URIs and file names.
+var sessionIDPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._:-]{0,63}$`)
+
+// BranchState is where a branch is in its lifecycle.
+type BranchState string
+
+const (
+	// BranchOpen branches take new thoughts. Branches start open.
+	BranchOpen BranchState = "open"
+	// BranchAbandoned branches take no new thoughts until reopened.
+	BranchAbandoned BranchState = "abandoned"
+	// BranchChosen marks the winning branch. At most one branch of a
+	// session is chosen at a time.
+	BranchChosen BranchState = "chosen"
+)
+
+// branchStates lists the names of the branch states.
+var branchStates = []string{string(BranchOpen), string(BranchAbandoned), string(BranchChosen)}
+
+// Branch is an alternative line of thought that diverges from FromThought.
+type Branch struct {
+	ID          string      `json:"id"`
+	FromThought int         `json:"fromThought"`
+	Thoughts    []int       `json:"thoughts"`
+	State       BranchState `json:"state"`
+	// Reason explains the latest change of state, if one was given.
+	Reason string `json:"reason,omitempty"`
+	// MergedInto is the latest thought that merged the branch back into
+	// another line of thought, if any.
+	MergedInto *ThoughtRef `json:"mergedInto,omitempty"`
+}
+
+// SessionSummary describes a session as listed by list_sessions.
+type SessionSummary struct {
+	ID            string `json:"id"`
+	Thoughts      int    `json:"thoughts"`
+	Branches      int    `json:"branches"`
+	LastThought   int    `json:"lastThought,omitempty"`
+	TotalThoughts int    `json:"totalThoughts,omitempty"`
+	Complete      bool   `json:"complete"`
+}
+
+// BranchStatus is a branch as listed in sequential_thinking responses.
+type BranchStatus struct {
+	ID     string      `json:"id"`
+	State  BranchState `json:"state"`
+	Reason string      `json:"reason,omitempty"`
+}
+
+// AppendResult describes a session right after a thought was recorded.
+type AppendResult struct {
+	HistoryLength int
+	// Branches lists the branches of the session in creation order.
+	Branches []BranchStatus
+}
+
+// ThoughtStore keeps the thought history of every session in memory, and
+// hands every recorded thought to its persister, if any.
+//
+// It is safe for concurrent use. The store lock only guards the set of
+// sessions, while every session has a lock of its own, so calls for
+// different sessions do not wait for each other and calls for the same
+// session are applied one at a time, in the order they take its lock. When
+// both are needed, the store lock is taken first.
+type ThoughtStore struct {
+	mu         sync.RWMutex
+	sessions   map[string]*thoughtSession
+	maxHistory int
+	persister  Persister
+	// shared is set when several clients use the store at once.
+	shared bool
+
+	// current is kept apart from the store lock, since it is updated while
+	// a session lock is held.
+	current atomic.Value
+}
+
+type thoughtSession struct {
+	mu          sync.Mutex
+	history     []ThoughtData
+	branches    map[string]*Branch
+	branchOrder []string
+	// numbered holds the positions in history of the thoughts with each
+	// number, so that checks do not scan the whole history.
+	numbered map[int][]int
+
+	// started is set for sessions created by StartSession, which are
+	// listed before they record their first thought.
+	started bool
+	// ended is set once the session is removed from the store, so that a
+	// call that looked it up just before retries with a fresh session.
+	ended bool
+}
+
+func newThoughtSession() *thoughtSession {
+	return &thoughtSession{
+		branches: make(map[string]*Branch),
+		numbered: make(map[int][]int),
+	}
+}
+
+// visible reports whether the session is listed, which excludes sessions
+// created by a first thought that was rejected.
+func (sess *thoughtSession) visible() bool {
+	return sess.started || len(sess.history) > 0
+}
+
+// NewThoughtStore creates an empty thought store.
+func NewThoughtStore() *ThoughtStore {
+	s := &ThoughtStore{sessions: make(map[string]*thoughtSession)}
+	s.current.Store(defaultSessionID)
+	return s
+}
+
+// SetHistoryLimit limits the number of thoughts a session can record. Zero
+// means no limit.
+func (s *ThoughtStore) SetHistoryLimit(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.maxHistory = n
+}
+
+// SetShared tells the store whether several clients use it at once, as over
+// the http and sse transports. A shared store has no default or current
+// session, so that a client that leaves out the session ID neither writes
+// into nor reads the sessions of another.
+func (s *ThoughtStore) SetShared(shared bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.shared = shared
+}
+
+func (s *ThoughtStore) isShared() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.shared
+}
+
+// SessionForThought returns the session a thought without a session ID goes
+// to: the default session or, in a shared store, a new session for a first
+// thought. Later thoughts in a shared store must name their session.
+func (s *ThoughtStore) SessionForThought(thoughtNumber int) (string, error) {
+	if !s.isShared() {
+		return defaultSessionID, nil
+	}
+	if thoughtNumber > 1 {
+		fe := requiredError("sessionId")
+		fe.Hint = "pass the sessionId returned with thought 1; this server is shared by several clients"
+		return "", fieldError(fe)
+	}
+	// The session is created by the thought, so a rejected thought does not
+	// leave an empty session behind.
+	return newSessionID()
+}
+
+// SessionOrCurrent returns id, or the current session if id is empty. A
+// shared store has no current session, so id is required.
+func (s *ThoughtStore) SessionOrCurrent(id string) (string, error) {
+	if id != "" {
+		return id, nil
+	}
+	if current := s.CurrentSession(); current != "" {
+		return current, nil
+	}
+	fe := requiredError("sessionId")
+	fe.Hint = "name the session; this server is shared by several clients"
+	return "", fieldError(fe)
+}
+
+// Restore replays the sessions recorded by p and persists every thought
+// appended from now on with it. Replayed thoughts are checked like new ones,
+// so a damaged file cannot leave a session in an inconsistent state.
+func (s *ThoughtStore) Restore(p Persister) error {
+	sessions, err := p.Load()
+	if err != nil {
+		return fmt.Errorf("failed to restore sessions: %v", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, thoughts := range sessions {
+		sess := newThoughtSession()
+		s.sessions[id] = sess
+		for _, data := range thoughts {
+			if err := sess.check(&data); err != nil {
+				return fmt.Errorf("failed to restore session %q: %v", id, err)
+			}
+			sess.record(data)
+		}
+	}
+	s.persister = p
+	return nil
+}
+
+// checkSessionID rejects IDs that do not match sessionIDPattern and the alias
+// that resources use for the current session.
+func checkSessionID(id string) error {
+	if !sessionIDPattern.MatchString(id) {
+		return fieldError(FieldError{
+			Field:   "sessionId",
+			Rule:    "pattern",
+			Message: fmt.Sprintf("invalid sessionId %q, use up to 64 letters, digits, '.', '_', ':' or '-'", id),
+			Value:   id,
+		})
+	}
+	if id == currentSessionAlias {
+		return fieldError(FieldError{
+			Field:   "sessionId",
+			Rule:    "reserved",
+			Message: fmt.Sprintf("sessionId %q is reserved for the current session in resource URIs", id),
+			Value:   id,
+			Hint:    "choose another session ID",
+		})
+	}
+	return nil
+}
+
+// lockSession returns the session called id with its lock held, creating the
+// session if it does not exist.
+func (s *ThoughtStore) lockSession(id string) *thoughtSession {
+	for {
+		s.mu.RLock()
+		sess, ok := s.sessions[id]
+		s.mu.RUnlock()
+
+		if !ok {
+			s.mu.Lock()
+			if sess, ok = s.sessions[id]; !ok {
+				sess = newThoughtSession()
+				s.sessions[id] = sess
+			}
+			s.mu.Unlock()
+		}
+
+		sess.mu.Lock()
+		if !sess.ended {
+			return sess
+		}
+		sess.mu.Unlock()
+	}
+}
+
+// lookup returns the session called id, or nil if there is none.
+func (s *ThoughtStore) lookup(id string) *thoughtSession {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.sessions[id]
+}
+
+// StartSession creates an empty session. An empty id asks for a new, random
+// one. It returns the ID of the session.
+func (s *ThoughtStore) StartSession(id string) (string, error) {
+	if id == "" {
+		var err error
+		if id, err = newSessionID(); err != nil {
+			return "", err
+		}
+	} else if err := checkSessionID(id); err != nil {
+		return "", err
+	}
+
+	sess := s.lockSession(id)
+	defer sess.mu.Unlock()
+
+	if sess.visible() {
+		return "", fmt.Errorf("session %q already exists", id)
+	}
+	sess.started = true
+	return id, nil
+}
+
+// EndSession discards a session and everything it recorded, including its
+// persisted thoughts. It returns the number of thoughts discarded.
+func (s *ThoughtStore) EndSession(id string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sess, ok := s.sessions[id]
+	if !ok {
+		return 0, fmt.Errorf("session %q does not exist", id)
+	}
+
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+
+	if !sess.visible() {
+		return 0, fmt.Errorf("session %q does not exist", id)
+	}
+	if s.persister != nil {
+		if err := s.persister.Delete(id); err != nil {
+			return 0, fmt.Errorf("failed to delete persisted session: %v", err)
+		}
+	}
+
+	sess.ended = true
+	delete(s.sessions, id)
+	s.current.CompareAndSwap(id, defaultSessionID)
+	return len(sess.history), nil
+}
+
+// Append checks a thought against the session history and records it. The
+// session is created by its first thought if it was not started before.
+func (s *ThoughtStore) Append(sessionID string, data ThoughtData) (AppendResult, error) {
+	if err := checkSessionID(sessionID); err != nil {
+		return AppendResult{}, err
+	}
+
+	s.mu.RLock()
+	maxHistory, persister := s.maxHistory, s.persister
+	s.mu.RUnlock()
+
+	sess := s.lockSession(sessionID)
+	defer sess.mu.Unlock()
+
+	if maxHistory > 0 && len(sess.history) >= maxHistory {
+		return AppendResult{}, fieldError(FieldError{
+			Field:   "thoughtNumber",
+			Rule:    "limit",
+			Message: fmt.Sprintf("session %q reached the limit of %d thoughts", sessionID, maxHistory),
+			Value:   data.ThoughtNumber,
+			Hint:    "continue in a new session",
+		})
+	}
+	if err := sess.check(&data); err != nil {
+		return AppendResult{}, err
+	}
+	// Persisting under the session lock keeps the stored order the same
+	// as the order of the history.
+	if persister != nil {
+		if err := persister.Append(sessionID, data); err != nil {
+			return AppendResult{}, fieldError(FieldError{
+				Field:   "thought",
+				Rule:    "storage",
+				Message: fmt.Sprintf("failed to persist thought: %v", err),
+				Hint:    "the thought was not recorded, send it again",
+			})
+		}
+	}
+	sess.record(data)
+	s.current.Store(sessionID)
+
+	branches := make([]BranchStatus, 0, len(sess.branchOrder))
+	for _, id := range sess.branchOrder {
+		b := sess.branches[id]
+		branches = append(branches, BranchStatus{ID: b.ID, State: b.State, Reason: b.Reason})
+	}
+	return AppendResult{
+		HistoryLength: len(sess.history),
+		Branches:      branches,
+	}, nil
+}
+
+// CurrentSession returns the session that most recently recorded a thought,
+// or an empty string for a shared store.
+func (s *ThoughtStore) CurrentSession() string {
+	if s.isShared() {
+		return ""
+	}
+	return s.current.Load().(string)
+}
+
+// Sessions returns the IDs of all sessions, sorted.
+func (s *ThoughtStore) Sessions() []string {
+	summaries := s.Summaries()
+
+	ids := make([]string, 0, len(summaries))
+	for _, summary := range summaries {
+		ids = append(ids, summary.ID)
+	}
+	return ids
+}
+
+// Summaries describes all sessions, sorted by ID.
+func (s *ThoughtStore) Summaries() []SessionSummary {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	summaries := make([]SessionSummary, 0, len(s.sessions))
+	for id, sess := range s.sessions {
+		if summary, ok := sess.summary(id); ok {
+			summaries = append(summaries, summary)
+		}
+	}
+	sort.Slice(summaries, func(i, j int) bool { return summaries[i].ID < summaries[j].ID })
+	return summaries
+}
+
+func (sess *thoughtSession) summary(id string) (SessionSummary, bool) {
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+
+	if !sess.visible() {
+		return SessionSummary{}, false
+	}
+
+	summary := SessionSummary{
+		ID:       id,
+		Thoughts: len(sess.history),
+		Branches: len(sess.branchOrder),
+	}
+	if n := len(sess.history); n > 0 {
+		last := sess.history[n-1]
+		summary.LastThought = last.ThoughtNumber
+		summary.TotalThoughts = last.TotalThoughts
+		summary.Complete = isFinal(&last)
+	}
+	return summary, true
+}
+
+// History returns a copy of the thoughts recorded for a session.
+func (s *ThoughtStore) History(sessionID string) []ThoughtData {
+	sess := s.lookup(sessionID)
+	if sess == nil {
+		return nil
+	}
+
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+
+	return append([]ThoughtData(nil), sess.history...)
+}
+
+// Branches returns a copy of the branches of a session in creation order.
+func (s *ThoughtStore) Branches(sessionID string) []Branch {
+	sess := s.lookup(sessionID)
+	if sess == nil {
+		return nil
+	}
+
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+
+	branches := make([]Branch, 0, len(sess.branchOrder))
+	for _, id := range sess.branchOrder {
+		b := *sess.branches[id]
+		b.Thoughts = append([]int(nil), b.Thoughts...)
+		if b.MergedInto != nil {
+			b.MergedInto = ptr(*b.MergedInto)
+		}
+		branches = append(branches, b)
+	}
+	return branches
+}
+
+func (sess *thoughtSession) hasThought(number int) bool {
+	return len(sess.numbered[number]) > 0
+}
+
+func (sess *thoughtSession) check(data *ThoughtData) error {
+	if data.BranchFromThought != nil && !sess.hasThought(*data.BranchFromThought) {
+		return fieldError(FieldError{
+			Field:   "branchFromThought",
+			Rule:    "exists",
+			Message: fmt.Sprintf("branchFromThought %d does not refer to a recorded thought", *data.BranchFromThought),
+			Value:   *data.BranchFromThought,
+		})
+	}
+
+	origin := 0
+	if data.BranchID != "" {
+		branch, ok := sess.branches[data.BranchID]
+		switch {
+		case !ok && data.BranchFromThought == nil:
+			return fieldError(FieldError{
+				Field:   "branchId",
+				Rule:    "exists",
+				Message: fmt.Sprintf("branch %q does not exist, set branchFromThought to start it", data.BranchID),
+				Value:   data.BranchID,
+				Hint:    "set branchFromThought to the thought the branch diverges from",
+			})
+		case !ok:
+			origin = *data.BranchFromThought
+		case data.BranchFromThought != nil && *data.BranchFromThought != branch.FromThought:
+			return fieldError(FieldError{
+				Field:   "branchFromThought",
+				Rule:    "conflict",
+				Message: fmt.Sprintf("branch %q already starts at thought %d", data.BranchID, branch.FromThought),
+				Value:   *data.BranchFromThought,
+				Hint:    fmt.Sprintf("leave out branchFromThought or set it to %d", branch.FromThought),
+			})
+		default:
+			origin = branch.FromThought
+		}
+
+		if ok && branch.State == BranchAbandoned && data.BranchState != BranchOpen {
+			fe := FieldError{
+				Field:   "branchId",
+				Rule:    "state",
+				Message: fmt.Sprintf("branch %q was abandoned", data.BranchID),
+				Value:   data.BranchID,
+				Hint:    "set branchState to open to reopen it",
+			}
+			if branch.Reason != "" {
+				fe.Message += ": " + branch.Reason
+			}
+			return fieldError(fe)
+		}
+	}
+
+	if data.MergeBranch != "" {
+		if err := sess.checkMerge(data); err != nil {
+			return err
+		}
+	}
+
+	if data.RevisesThought != nil {
+		return sess.checkRevision(*data.RevisesThought, data.BranchID, origin)
+	}
+	return nil
+}
+
+// checkRevision makes sure the revised thought is part of the line of
+// thought the revision is made on: the branch itself, or the main line up to
+// the point where the branch diverged.
+func (sess *thoughtSession) checkRevision(target int, branchID string, origin int) error {
+	if !sess.hasThought(target) {
+		return fieldError(FieldError{
+			Field:   "revisesThought",
+			Rule:    "exists",
+			Message: fmt.Sprintf("revisesThought %d does not refer to a recorded thought", target),
+			Value:   target,
+		})
+	}
+
+	for _, i := range sess.numbered[target] {
+		t := sess.history[i]
+		if t.BranchID == branchID || (t.BranchID == "" && target <= origin) {
+			return nil
+		}
+	}
+
+	fe := FieldError{
+		Field:   "revisesThought",
+		Rule:    "line",
+		Message: fmt.Sprintf("revisesThought %d is not on branch %q", target, branchID),
+		Value:   target,
+	}
+	if branchID == "" {
+		fe.Message = fmt.Sprintf("revisesThought %d is not on the main line", target)
+		fe.Hint = "set branchId to revise a thought of a branch"
+	}
+	return fieldError(fe)
+}
+
+// checkMerge makes sure the merged branch exists and is not the line of
+// thought it is merged into.
+func (sess *thoughtSession) checkMerge(data *ThoughtData) error {
+	if _, ok := sess.branches[data.MergeBranch]; !ok {
+		return fieldError(FieldError{
+			Field:   "mergeBranch",
+			Rule:    "exists",
+			Message: fmt.Sprintf("branch %q does not exist", data.MergeBranch),
+			Value:   data.MergeBranch,
+		})
+	}
+	if data.MergeBranch == data.BranchID {
+		return fieldError(FieldError{
+			Field:   "mergeBranch",
+			Rule:    "conflict",
+			Message: fmt.Sprintf("branch %q cannot be merged into itself", data.MergeBranch),
+			Value:   data.MergeBranch,
+			Hint:    "leave out branchId to merge into the main line",
+		})
+	}
+	return nil
+}
+
+func (sess *thoughtSession) record(data ThoughtData) {
+	sess.numbered[data.ThoughtNumber] = append(sess.numbered[data.ThoughtNumber], len(sess.history))
+	sess.history = append(sess.history, data)
+
+	if data.MergeBranch != "" {
+		sess.branches[data.MergeBranch].MergedInto = &ThoughtRef{ThoughtNumber: data.ThoughtNumber, BranchID: data.BranchID}
+	}
+
+	if data.BranchID == "" {
+		return
+	}
+
+	branch, ok := sess.branches[data.BranchID]
+	if !ok {
+		branch = &Branch{ID: data.BranchID, FromThought: *data.BranchFromThought, State: BranchOpen}
+		sess.branches[data.BranchID] = branch
+		sess.branchOrder = append(sess.branchOrder, data.BranchID)
+	}
+	branch.Thoughts = append(branch.Thoughts, data.ThoughtNumber)
+
+	if data.BranchState == "" {
+		return
+	}
+	if data.BranchState == BranchChosen {
+		// Choosing a branch reopens the one chosen before it.
+		for _, other := range sess.branches {
+			if other != branch && other.State == BranchChosen {
+				other.State, other.Reason = BranchOpen, ""
+			}
+		}
+	}
+	branch.State, branch.Reason = data.BranchState, data.BranchReason
+}
@@ -0,0 +1,540 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/strowk/foxy-contexts/pkg/mcp"
+)
+
+func TestThoughtStore(t *testing.T) {
+	t.Run("append grows history", func(t *testing.T) {
+		store := NewThoughtStore()
+
+		for i := 1; i <= 3; i++ {
+			state, err := store.Append(defaultSessionID, ThoughtData{Thought: "step", ThoughtNumber: i, TotalThoughts: 3})
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if state.HistoryLength != i {
+				t.Errorf("Expected history length %d, got %d", i, state.HistoryLength)
+			}
+		}
+
+		history := store.History(defaultSessionID)
+		if len(history) != 3 {
+			t.Fatalf("Expected 3 recorded thoughts, got %d", len(history))
+		}
+		if history[2].ThoughtNumber != 3 {
+			t.Errorf("Expected last thought number 3, got %d", history[2].ThoughtNumber)
+		}
+	})
+
+	t.Run("sessions are kept apart", func(t *testing.T) {
+		store := NewThoughtStore()
+		_, _ = store.Append("a", ThoughtData{Thought: "a1", ThoughtNumber: 1, TotalThoughts: 1})
+
+		if history := store.History("b"); len(history) != 0 {
+			t.Errorf("Expected empty history for unknown session, got %v", history)
+		}
+	})
+
+	t.Run("history is a copy", func(t *testing.T) {
+		store := NewThoughtStore()
+		_, _ = store.Append(defaultSessionID, ThoughtData{Thought: "original", ThoughtNumber: 1, TotalThoughts: 1})
+
+		history := store.History(defaultSessionID)
+		history[0].Thought = "changed"
+
+		if got := store.History(defaultSessionID)[0].Thought; got != "original" {
+			t.Errorf("Expected stored thought to be unchanged, got '%s'", got)
+		}
+	})
+}
+
+func TestThoughtStoreBranches(t *testing.T) {
+	newStore := func(t *testing.T) *ThoughtStore {
+		t.Helper()
+		store := NewThoughtStore()
+		for i := 1; i <= 2; i++ {
+			if _, err := store.Append(defaultSessionID, ThoughtData{Thought: "main", ThoughtNumber: i, TotalThoughts: 4}); err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+		}
+		return store
+	}
+
+	t.Run("records branch origin and members", func(t *testing.T) {
+		store := newStore(t)
+
+		state, err := store.Append(defaultSessionID, ThoughtData{Thought: "alt", ThoughtNumber: 3, TotalThoughts: 4, BranchFromThought: ptr(2), BranchID: "alt"})
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if want := []BranchStatus{{ID: "alt", State: BranchOpen}}; !reflect.DeepEqual(state.Branches, want) {
+			t.Errorf("Expected branches [alt], got %v", state.Branches)
+		}
+
+		// Later thoughts may continue the branch by id alone.
+		if _, err := store.Append(defaultSessionID, ThoughtData{Thought: "alt", ThoughtNumber: 4, TotalThoughts: 4, BranchID: "alt"}); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		branches := store.Branches(defaultSessionID)
+		if len(branches) != 1 {
+			t.Fatalf("Expected 1 branch, got %d", len(branches))
+		}
+		if branches[0].FromThought != 2 {
+			t.Errorf("Expected branch origin 2, got %d", branches[0].FromThought)
+		}
+		if len(branches[0].Thoughts) != 2 || branches[0].Thoughts[0] != 3 || branches[0].Thoughts[1] != 4 {
+			t.Errorf("Expected branch thoughts [3 4], got %v", branches[0].Thoughts)
+		}
+	})
+
+	t.Run("unknown branchFromThought is rejected", func(t *testing.T) {
+		store := newStore(t)
+
+		_, err := store.Append(defaultSessionID, ThoughtData{Thought: "alt", ThoughtNumber: 3, TotalThoughts: 4, BranchFromThought: ptr(7), BranchID: "alt"})
+		if err == nil {
+			t.Fatal("Expected error for unknown branchFromThought")
+		}
+		if !strings.Contains(err.Error(), "branchFromThought 7") {
+			t.Errorf("Expected branchFromThought error, got %v", err)
+		}
+		if n := len(store.History(defaultSessionID)); n != 2 {
+			t.Errorf("Expected rejected thought not to be recorded, got %d thoughts", n)
+		}
+	})
+
+	t.Run("unknown branch without origin is rejected", func(t *testing.T) {
+		store := newStore(t)
+
+		if _, err := store.Append(defaultSessionID, ThoughtData{Thought: "alt", ThoughtNumber: 3, TotalThoughts: 4, BranchID: "missing"}); err == nil {
+			t.Fatal("Expected error for unknown branch")
+		}
+	})
+
+	t.Run("branch origin cannot move", func(t *testing.T) {
+		store := newStore(t)
+
+		if _, err := store.Append(defaultSessionID, ThoughtData{Thought: "alt", ThoughtNumber: 3, TotalThoughts: 4, BranchFromThought: ptr(2), BranchID: "alt"}); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if _, err := store.Append(defaultSessionID, ThoughtData{Thought: "alt", ThoughtNumber: 4, TotalThoughts: 4, BranchFromThought: ptr(1), BranchID: "alt"}); err == nil {
+			t.Fatal("Expected error for moving branch origin")
+		}
+	})
+
+	t.Run("merges record where the branch went", func(t *testing.T) {
+		store := newStore(t)
+
+		if _, err := store.Append(defaultSessionID, ThoughtData{Thought: "alt", ThoughtNumber: 3, TotalThoughts: 4, BranchFromThought: ptr(2), BranchID: "alt"}); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if _, err := store.Append(defaultSessionID, ThoughtData{Thought: "merge", ThoughtNumber: 4, TotalThoughts: 4, MergeBranch: "alt"}); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		branches := store.Branches(defaultSessionID)
+		if want := (ThoughtRef{ThoughtNumber: 4}); branches[0].MergedInto == nil || *branches[0].MergedInto != want {
+			t.Errorf("Expected branch merged into thought 4, got %v", branches[0].MergedInto)
+		}
+	})
+
+	t.Run("invalid merges are rejected", func(t *testing.T) {
+		store := newStore(t)
+
+		if _, err := store.Append(defaultSessionID, ThoughtData{Thought: "alt", ThoughtNumber: 3, TotalThoughts: 4, BranchFromThought: ptr(2), BranchID: "alt"}); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		for _, data := range []ThoughtData{
+			{Thought: "merge", ThoughtNumber: 4, TotalThoughts: 4, MergeBranch: "missing"},
+			{Thought: "merge", ThoughtNumber: 4, TotalThoughts: 4, BranchID: "alt", MergeBranch: "alt"},
+		} {
+			if _, err := store.Append(defaultSessionID, data); err == nil || !strings.Contains(err.Error(), "branch") {
+				t.Errorf("Expected merge of %q on %q to be rejected, got %v", data.MergeBranch, data.BranchID, err)
+			}
+		}
+		if n := len(store.History(defaultSessionID)); n != 3 {
+			t.Errorf("Expected rejected merges not to be recorded, got %d thoughts", n)
+		}
+	})
+}
+
+func TestThoughtStoreBranchStates(t *testing.T) {
+	store := NewThoughtStore()
+	appendThought := func(data ThoughtData) error {
+		data.Thought, data.TotalThoughts = "thought", 5
+		_, err := store.Append(defaultSessionID, data)
+		return err
+	}
+	states := func() map[string]BranchState {
+		states := map[string]BranchState{}
+		for _, b := range store.Branches(defaultSessionID) {
+			states[b.ID] = b.State
+		}
+		return states
+	}
+
+	for _, data := range []ThoughtData{
+		{ThoughtNumber: 1},
+		{ThoughtNumber: 2, BranchFromThought: ptr(1), BranchID: "a"},
+		{ThoughtNumber: 2, BranchFromThought: ptr(1), BranchID: "b"},
+		{ThoughtNumber: 3, BranchID: "a", BranchState: BranchAbandoned, BranchReason: "dead end"},
+	} {
+		if err := appendThought(data); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	}
+	if want := map[string]BranchState{"a": BranchAbandoned, "b": BranchOpen}; !reflect.DeepEqual(states(), want) {
+		t.Errorf("States = %v, want %v", states(), want)
+	}
+	if branches := store.Branches(defaultSessionID); branches[0].Reason != "dead end" {
+		t.Errorf("Expected the reason to be kept, got %q", branches[0].Reason)
+	}
+
+	t.Run("abandoned branches take no thoughts", func(t *testing.T) {
+		if err := appendThought(ThoughtData{ThoughtNumber: 4, BranchID: "a"}); err == nil || !strings.Contains(err.Error(), "dead end") {
+			t.Errorf("Expected the thought to be rejected with the reason, got %v", err)
+		}
+	})
+
+	t.Run("reopening and choosing", func(t *testing.T) {
+		if err := appendThought(ThoughtData{ThoughtNumber: 4, BranchID: "a", BranchState: BranchOpen}); err != nil {
+			t.Fatalf("Expected the branch to be reopened, got %v", err)
+		}
+		if err := appendThought(ThoughtData{ThoughtNumber: 3, BranchID: "b", BranchState: BranchChosen}); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if err := appendThought(ThoughtData{ThoughtNumber: 5, BranchID: "a", BranchState: BranchChosen, BranchReason: "simpler after all"}); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		// Only one branch is chosen at a time.
+		if want := map[string]BranchState{"a": BranchChosen, "b": BranchOpen}; !reflect.DeepEqual(states(), want) {
+			t.Errorf("States = %v, want %v", states(), want)
+		}
+	})
+}
+
+func TestThoughtStoreRevisions(t *testing.T) {
+	newStore := func(t *testing.T) *ThoughtStore {
+		t.Helper()
+		store := NewThoughtStore()
+		thoughts := []ThoughtData{
+			{Thought: "main", ThoughtNumber: 1, TotalThoughts: 5},
+			{Thought: "main", ThoughtNumber: 2, TotalThoughts: 5},
+			{Thought: "main", ThoughtNumber: 3, TotalThoughts: 5},
+			{Thought: "alt", ThoughtNumber: 4, TotalThoughts: 5, BranchFromThought: ptr(2), BranchID: "alt"},
+		}
+		for _, data := range thoughts {
+			if _, err := store.Append(defaultSessionID, data); err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+		}
+		return store
+	}
+
+	revision := func(number, target int, branchID string) ThoughtData {
+		return ThoughtData{
+			Thought:        "revision",
+			ThoughtNumber:  number,
+			TotalThoughts:  5,
+			IsRevision:     ptr(true),
+			RevisesThought: ptr(target),
+			BranchID:       branchID,
+		}
+	}
+
+	testCases := []struct {
+		name    string
+		data    ThoughtData
+		wantErr string
+	}{
+		{name: "main line revision", data: revision(5, 3, "")},
+		{name: "branch revises its own thought", data: revision(5, 4, "alt")},
+		{name: "branch revises shared main line", data: revision(5, 2, "alt")},
+		{name: "main line revises branch thought", data: revision(5, 4, ""), wantErr: "revisesThought 4 is not on the main line"},
+		{name: "never recorded", data: revision(9, 8, ""), wantErr: "revisesThought 8 does not refer to a recorded thought"},
+		{name: "branch revises main line after fork", data: revision(5, 3, "alt"), wantErr: `revisesThought 3 is not on branch "alt"`},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			store := newStore(t)
+
+			_, err := store.Append(defaultSessionID, tc.data)
+			if tc.wantErr == "" {
+				if err != nil {
+					t.Errorf("Expected no error, got %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("Expected error containing '%s', got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestThoughtStoreHistoryLimit(t *testing.T) {
+	store := NewThoughtStore()
+	store.SetHistoryLimit(2)
+
+	for i := 1; i <= 2; i++ {
+		if _, err := store.Append(defaultSessionID, ThoughtData{Thought: "step", ThoughtNumber: i, TotalThoughts: 3}); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	}
+
+	_, err := store.Append(defaultSessionID, ThoughtData{Thought: "step", ThoughtNumber: 3, TotalThoughts: 3})
+	if err == nil || !strings.Contains(err.Error(), "limit of 2 thoughts") {
+		t.Errorf("Expected history limit error, got %v", err)
+	}
+}
+
+func TestSequentialThinkingToolExtension(t *testing.T) {
+	handler := NewSequentialThinkingTool(NewThoughtStore(), Options{ExtendTotal: true}).Callback
+
+	result := handler(map[string]any{"thought": "first", "thoughtNumber": 1, "totalThoughts": 1})
+	if result.IsError != nil && *result.IsError {
+		t.Fatalf("First thought failed: %v", result.Content)
+	}
+
+	result = handler(map[string]any{"thought": "second", "thoughtNumber": 2, "totalThoughts": 1})
+	if result.IsError != nil && *result.IsError {
+		t.Fatalf("Second thought failed: %v", result.Content)
+	}
+	if total := result.Meta["totalThoughts"]; total != 2 {
+		t.Errorf("Expected adjusted totalThoughts = 2 in meta, got %v", total)
+	}
+	if text := result.Content[0].(mcp.TextContent).Text; !strings.Contains(text, "💭 Thought 2/2") {
+		t.Errorf("Expected adjusted estimate in output, got: %s", text)
+	}
+
+	result = handler(map[string]any{"thought": "third", "thoughtNumber": 3, "totalThoughts": 3, "needsMoreThoughts": true})
+	if result.IsError != nil && *result.IsError {
+		t.Fatalf("Third thought failed: %v", result.Content)
+	}
+	if extended := result.Meta["extended"]; extended != true {
+		t.Errorf("Expected extended = true in meta, got %v", extended)
+	}
+	if extendedBy := result.Meta["extendedBy"]; extendedBy != 1 {
+		t.Errorf("Expected extendedBy = 1 in meta, got %v", extendedBy)
+	}
+	if nextNeeded := result.Meta["nextThoughtNeeded"]; nextNeeded != true {
+		t.Errorf("Expected nextThoughtNeeded = true in meta, got %v", nextNeeded)
+	}
+}
+
+func TestSequentialThinkingToolHistory(t *testing.T) {
+	handler := NewSequentialThinkingTool(NewThoughtStore(), Options{}).Callback
+
+	for i := 1; i <= 3; i++ {
+		result := handler(map[string]any{
+			"thought":       "step",
+			"thoughtNumber": i,
+			"totalThoughts": 3,
+		})
+		if result.IsError != nil && *result.IsError {
+			t.Fatalf("Thought %d failed: %v", i, result.Content)
+		}
+		if histLen := result.Meta["thoughtHistoryLength"]; histLen != i {
+			t.Errorf("Expected thoughtHistoryLength = %d, got %v", i, histLen)
+		}
+	}
+
+	// Rejected thoughts must not be recorded.
+	result := handler(map[string]any{"thoughtNumber": 4, "totalThoughts": 4})
+	if result.IsError == nil || !*result.IsError {
+		t.Fatal("Expected validation error")
+	}
+
+	result = handler(map[string]any{"thought": "step", "thoughtNumber": 4, "totalThoughts": 4})
+	if histLen := result.Meta["thoughtHistoryLength"]; histLen != 4 {
+		t.Errorf("Expected thoughtHistoryLength = 4, got %v", histLen)
+	}
+
+	result = handler(map[string]any{
+		"thought":        "revise",
+		"thoughtNumber":  5,
+		"totalThoughts":  5,
+		"isRevision":     true,
+		"revisesThought": 4,
+		"branchId":       "elsewhere",
+	})
+	if result.IsError == nil || !*result.IsError {
+		t.Fatal("Expected validation error for unknown branch")
+	}
+	if text := result.Content[0].(mcp.TextContent).Text; !strings.HasPrefix(text, "Validation error: ") {
+		t.Errorf("Expected validation error text, got: %s", text)
+	}
+}
+
+func TestThoughtStoreConcurrency(t *testing.T) {
+	const sessions, thoughts = 20, 25
+
+	t.Run("parallel calls across sessions", func(t *testing.T) {
+		store := NewThoughtStore()
+		handler := NewSequentialThinkingTool(store, Options{}).Callback
+
+		lengths := make([][]int, sessions)
+		for i := range lengths {
+			lengths[i] = make([]int, thoughts)
+		}
+
+		var wg sync.WaitGroup
+		for s := 0; s < sessions; s++ {
+			for n := 1; n <= thoughts; n++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					result := handler(map[string]any{
+						"thought":       "parallel",
+						"thoughtNumber": n,
+						"totalThoughts": thoughts,
+						"sessionId":     fmt.Sprintf("s%d", s),
+					})
+					if result.IsError != nil && *result.IsError {
+						t.Errorf("Expected no error, got %v", result.Content)
+						return
+					}
+					lengths[s][n-1] = result.Meta["thoughtHistoryLength"].(int)
+				}()
+			}
+		}
+		wg.Wait()
+
+		for s := 0; s < sessions; s++ {
+			history := store.History(fmt.Sprintf("s%d", s))
+			if len(history) != thoughts {
+				t.Fatalf("Expected %d thoughts in session s%d, got %d", thoughts, s, len(history))
+			}
+
+			// Every call saw its own history length, so no two appends
+			// to a session overlapped.
+			seen := make(map[int]bool)
+			for _, n := range lengths[s] {
+				seen[n] = true
+			}
+			if len(seen) != thoughts {
+				t.Errorf("Expected %d distinct history lengths in session s%d, got %v", thoughts, s, lengths[s])
+			}
+		}
+	})
+
+	t.Run("order within a session under load", func(t *testing.T) {
+		dir := t.TempDir()
+		p, err := NewJSONLPersister(dir)
+		if err != nil {
+			t.Fatalf("Failed to open persister: %v", err)
+		}
+		defer func() { _ = p.Close() }()
+
+		store := NewThoughtStore()
+		if err := store.Restore(p); err != nil {
+			t.Fatalf("Failed to restore: %v", err)
+		}
+		handler := NewSequentialThinkingTool(store, Options{}).Callback
+		list := NewListSessionsTool(store).Callback
+
+		stop := make(chan struct{})
+		var readers sync.WaitGroup
+		for i := 0; i < 8; i++ {
+			readers.Add(1)
+			go func() {
+				defer readers.Done()
+				for {
+					select {
+					case <-stop:
+						return
+					default:
+					}
+					list(map[string]any{})
+					for _, id := range store.Sessions() {
+						store.History(id)
+						store.Branches(id)
+						_, _ = readThoughtResource(store, resourceScheme+id)
+					}
+				}
+			}()
+		}
+
+		var writers sync.WaitGroup
+		for s := 0; s < sessions; s++ {
+			writers.Add(1)
+			go func() {
+				defer writers.Done()
+				id := fmt.Sprintf("ordered-%d", s)
+				for n := 1; n <= thoughts; n++ {
+					args := map[string]any{"thought": "step", "thoughtNumber": n, "totalThoughts": thoughts, "sessionId": id}
+					if n > 2 && n%2 == 1 {
+						args["branchFromThought"] = 2
+						args["branchId"] = "odd"
+					}
+					if result := handler(args); result.IsError != nil && *result.IsError {
+						t.Errorf("Expected no error, got %v", result.Content)
+					}
+				}
+			}()
+		}
+		writers.Wait()
+		close(stop)
+		readers.Wait()
+
+		persisted, err := p.Load()
+		if err != nil {
+			t.Fatalf("Failed to load: %v", err)
+		}
+		for s := 0; s < sessions; s++ {
+			id := fmt.Sprintf("ordered-%d", s)
+			history := store.History(id)
+			for i, data := range history {
+				if data.ThoughtNumber != i+1 {
+					t.Fatalf("Expected thought %d at position %d of %s, got %d", i+1, i, id, data.ThoughtNumber)
+				}
+				if persisted[id][i].ThoughtNumber != data.ThoughtNumber {
+					t.Fatalf("Expected persisted order of %s to match history", id)
+				}
+			}
+			if branches := store.Branches(id); len(branches) != 1 || len(branches[0].Thoughts) != thoughts/2 {
+				t.Errorf("Expected branch odd with %d thoughts in %s, got %v", thoughts/2, id, branches)
+			}
+		}
+	})
+
+	t.Run("sessions started and ended under load", func(t *testing.T) {
+		store := NewThoughtStore()
+		handler := NewSequentialThinkingTool(store, Options{}).Callback
+
+		var wg sync.WaitGroup
+		for s := 0; s < sessions; s++ {
+			id := fmt.Sprintf("churn-%d", s%4)
+			wg.Add(3)
+			go func() {
+				defer wg.Done()
+				_, _ = store.StartSession(id)
+			}()
+			go func() {
+				defer wg.Done()
+				for n := 1; n <= thoughts; n++ {
+					handler(map[string]any{"thought": "churn", "thoughtNumber": n, "totalThoughts": thoughts, "sessionId": id})
+				}
+			}()
+			go func() {
+				defer wg.Done()
+				_, _ = store.EndSession(id)
+			}()
+		}
+		wg.Wait()
+
+		for _, summary := range store.Summaries() {
+			if history := store.History(summary.ID); len(history) != summary.Thoughts {
+				t.Errorf("Expected summary of %s to match its history, got %d and %d", summary.ID, summary.Thoughts, len(history))
+			}
+		}
+	})
+}
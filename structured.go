@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/strowk/foxy-contexts/pkg/fxctx"
+	"github.com/strowk/foxy-contexts/pkg/jsonrpc2"
+	"github.com/strowk/foxy-contexts/pkg/mcp"
+	"github.com/strowk/foxy-contexts/pkg/server"
+)
+
+// The mcp package predates output schemas and structured content, and its
+// tool mux copies results field by field, so tools/list and tools/call are
+// served by the handlers below instead. They are registered after the ones
+// of the foxy app and replace them.
+
+// toolDefinition is a tool as listed by tools/list.
+type toolDefinition struct {
+	*mcp.Tool
+	OutputSchema map[string]any `json:"outputSchema,omitempty"`
+}
+
+type listToolsResult struct {
+	Tools []toolDefinition `json:"tools"`
+}
+
+// toolResult is the result of tools/call.
+type toolResult struct {
+	*mcp.CallToolResult
+	StructuredContent any `json:"structuredContent,omitempty"`
+}
+
+// structuredTool is implemented by tools that declare an output schema and
+// return structured content matching it.
+type structuredTool interface {
+	fxctx.Tool
+	OutputSchema() map[string]any
+	// CallStructured returns the result of the tool together with its
+	// structured content, which may be nil for results that are errors.
+	CallStructured(args map[string]any) (*mcp.CallToolResult, any)
+}
+
+type toolWithSchema struct {
+	tool         *mcp.Tool
+	outputSchema map[string]any
+	call         func(args map[string]any) (*mcp.CallToolResult, any)
+}
+
+// newStructuredTool creates a tool whose results carry structured content
+// described by outputSchema.
+func newStructuredTool(tool *mcp.Tool, outputSchema map[string]any, call func(args map[string]any) (*mcp.CallToolResult, any)) structuredTool {
+	return &toolWithSchema{tool: tool, outputSchema: outputSchema, call: call}
+}
+
+func (t *toolWithSchema) GetMcpTool() *mcp.Tool {
+	return t.tool
+}
+
+func (t *toolWithSchema) Callback(args map[string]any) *mcp.CallToolResult {
+	result, _ := t.call(args)
+	return result
+}
+
+func (t *toolWithSchema) OutputSchema() map[string]any {
+	return t.outputSchema
+}
+
+func (t *toolWithSchema) CallStructured(args map[string]any) (*mcp.CallToolResult, any) {
+	return t.call(args)
+}
+
+// registerToolHandlers serves tools/list and tools/call for tools.
+func registerToolHandlers(s server.Server, tools []fxctx.Tool) {
+	byName := make(map[string]fxctx.Tool, len(tools))
+	definitions := make([]toolDefinition, 0, len(tools))
+	for _, tool := range tools {
+		def := toolDefinition{Tool: tool.GetMcpTool()}
+		if st, ok := tool.(structuredTool); ok {
+			def.OutputSchema = st.OutputSchema()
+		}
+		byName[def.Name] = tool
+		definitions = append(definitions, def)
+	}
+
+	s.SetRequestHandler(&mcp.ListToolsRequest{}, func(jsonrpc2.Request) (jsonrpc2.Result, *jsonrpc2.Error) {
+		return &listToolsResult{Tools: definitions}, nil
+	})
+
+	s.SetRequestHandler(&mcp.CallToolRequest{}, func(r jsonrpc2.Request) (jsonrpc2.Result, *jsonrpc2.Error) {
+		req := r.(*mcp.CallToolRequest)
+		tool, ok := byName[req.Params.Name]
+		if !ok {
+			return nil, jsonrpc2.NewServerError(fxctx.ToolNotFound, fmt.Sprintf("tool not found: %s", req.Params.Name))
+		}
+
+		if st, ok := tool.(structuredTool); ok {
+			result, structured := st.CallStructured(req.Params.Arguments)
+			return &toolResult{CallToolResult: result, StructuredContent: structured}, nil
+		}
+		return &toolResult{CallToolResult: tool.Callback(req.Params.Arguments)}, nil
+	})
+}
+
+// toolTransport runs a transport with the tool handlers above registered on
+// every server it starts.
+type toolTransport struct {
+	server.Transport
+	tools []fxctx.Tool
+}
+
+// withToolHandlers wraps transport so that its servers serve tools.
+func withToolHandlers(transport server.Transport, tools []fxctx.Tool) server.Transport {
+	return &toolTransport{Transport: transport, tools: tools}
+}
+
+func (t *toolTransport) Run(
+	capabilities *mcp.ServerCapabilities,
+	serverInfo *mcp.Implementation,
+	options ...server.ServerOption,
+) error {
+	options = append(options, server.ServerStartCallbackOption{
+		Callback: func(s server.Server) { registerToolHandlers(s, t.tools) },
+	})
+	return t.Transport.Run(capabilities, serverInfo, options...)
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/strowk/foxy-contexts/pkg/fxctx"
+	"github.com/strowk/foxy-contexts/pkg/mcp"
+	"github.com/strowk/foxy-contexts/pkg/server"
+)
+
+func newToolServer(tools ...fxctx.Tool) *httpSession {
+	s := server.NewServer(
+		&mcp.ServerCapabilities{Tools: &mcp.ServerCapabilitiesTools{}},
+		&mcp.Implementation{Name: "sequential_thinking", Version: "test"},
+		server.ServerStartCallbackOption{Callback: func(s server.Server) { registerToolHandlers(s, tools) }},
+	)
+	return &httpSession{server: s}
+}
+
+// checkSchema makes sure a value fits a JSON schema object of the kind the
+// tools declare: known properties of the declared types, and the required
+// ones present.
+func checkSchema(t *testing.T, schema map[string]any, value any) {
+	t.Helper()
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		t.Fatalf("Failed to encode value: %v", err)
+	}
+	var doc map[string]any
+	if err := json.Unmarshal(data, &doc); err != nil {
+		t.Fatalf("Expected an object, got %s", data)
+	}
+
+	properties := schema["properties"].(map[string]any)
+	for key, v := range doc {
+		prop, ok := properties[key].(map[string]any)
+		if !ok {
+			t.Errorf("Property %s is not in the schema", key)
+			continue
+		}
+		var typ string
+		switch v.(type) {
+		case string:
+			typ = "string"
+		case bool:
+			typ = "boolean"
+		case float64:
+			typ = "integer"
+		case []any:
+			typ = "array"
+		case map[string]any:
+			typ = "object"
+		}
+		if prop["type"] != typ {
+			t.Errorf("Expected %s to be of type %v, got %s", key, prop["type"], typ)
+		}
+	}
+	// The value must have the required properties of the schema, or of
+	// one of its anyOf alternatives.
+	alternatives := []map[string]any{schema}
+	if anyOf, ok := schema["anyOf"].([]any); ok {
+		alternatives = nil
+		for _, alt := range anyOf {
+			alternatives = append(alternatives, alt.(map[string]any))
+		}
+	}
+	var missing []string
+	for _, alt := range alternatives {
+		missing = missing[:0]
+		required, _ := alt["required"].([]string)
+		for _, key := range required {
+			if _, ok := doc[key]; !ok {
+				missing = append(missing, key)
+			}
+		}
+		if len(missing) == 0 {
+			return
+		}
+	}
+	t.Errorf("Required properties %v are missing", missing)
+}
+
+func TestSequentialThinkingStructuredContent(t *testing.T) {
+	tool := NewSequentialThinkingTool(NewThoughtStore(), Options{ExtendTotal: true})
+
+	_, structured := tool.CallStructured(map[string]any{"thought": "first", "thoughtNumber": 1, "totalThoughts": 2})
+	result, structured := tool.CallStructured(map[string]any{
+		"thought":        "revised",
+		"thoughtNumber":  3,
+		"totalThoughts":  2,
+		"isRevision":     true,
+		"revisesThought": 1,
+	})
+	if result.IsError != nil && *result.IsError {
+		t.Fatalf("Expected no error, got %v", result.Content)
+	}
+
+	got, ok := structured.(*ThoughtResult)
+	if !ok {
+		t.Fatalf("Expected a ThoughtResult, got %T", structured)
+	}
+	if got.SessionID != defaultSessionID || got.Thought != "revised" || got.ThoughtNumber != 3 || got.TotalThoughts != 3 || got.ExtendedBy != 1 {
+		t.Errorf("Expected effective totals of thought 3, got %+v", got)
+	}
+	if got.RevisesThought == nil || *got.RevisesThought != 1 || got.ThoughtHistoryLength != 2 || got.NextThoughtNeeded {
+		t.Errorf("Expected revision of thought 1 concluding a history of 2, got %+v", got)
+	}
+	checkSchema(t, tool.OutputSchema(), got)
+
+	t.Run("errors list the rejected arguments", func(t *testing.T) {
+		result, structured := tool.CallStructured(map[string]any{"thought": "bad"})
+		if result.IsError == nil || !*result.IsError {
+			t.Fatal("Expected an error result")
+		}
+		failure, ok := structured.(*ValidationFailure)
+		if !ok {
+			t.Fatalf("Expected a ValidationFailure, got %T", structured)
+		}
+		if len(failure.Errors) != 2 || failure.Errors[0].Field != "thoughtNumber" || failure.Errors[1].Field != "totalThoughts" {
+			t.Errorf("Expected thoughtNumber and totalThoughts to be rejected, got %+v", failure.Errors)
+		}
+		checkSchema(t, tool.OutputSchema(), structured)
+	})
+
+	t.Run("thought text follows thought logging", func(t *testing.T) {
+		tool := NewSequentialThinkingTool(NewThoughtStore(), Options{DisableThoughtLogging: true})
+		_, structured := tool.CallStructured(map[string]any{"thought": "secret", "thoughtNumber": 1, "totalThoughts": 1})
+		if got := structured.(*ThoughtResult); got.Thought != "" {
+			t.Errorf("Expected no thought text, got %q", got.Thought)
+		}
+	})
+}
+
+func TestToolHandlers(t *testing.T) {
+	store := NewThoughtStore()
+	sess := newToolServer(NewSequentialThinkingTool(store, Options{}), NewListSessionsTool(store))
+
+	call := func(t *testing.T, msg string) map[string]any {
+		t.Helper()
+
+		data, ok := sess.call([]byte(msg))
+		if !ok {
+			t.Fatalf("Expected a response to %s", msg)
+		}
+		var res struct {
+			Result map[string]any `json:"result"`
+			Error  map[string]any `json:"error"`
+		}
+		if err := json.Unmarshal(data, &res); err != nil {
+			t.Fatalf("Failed to decode response %s: %v", data, err)
+		}
+		if res.Error != nil {
+			return res.Error
+		}
+		return res.Result
+	}
+
+	call(t, initializeMessage)
+
+	t.Run("tools/list declares output schemas", func(t *testing.T) {
+		result := call(t, `{"jsonrpc":"2.0","id":2,"method":"tools/list"}`)
+		tools := result["tools"].([]any)
+		if len(tools) != 2 {
+			t.Fatalf("Expected 2 tools, got %v", tools)
+		}
+		thinking, list := tools[0].(map[string]any), tools[1].(map[string]any)
+		if thinking["name"] != "sequential_thinking" || thinking["outputSchema"] == nil || thinking["inputSchema"] == nil {
+			t.Errorf("Expected sequential_thinking with input and output schema, got %v", thinking)
+		}
+		if _, ok := list["outputSchema"]; ok {
+			t.Errorf("Expected no output schema for list_sessions, got %v", list)
+		}
+	})
+
+	t.Run("tools/call returns structured content", func(t *testing.T) {
+		result := call(t, thoughtCall)
+		structured, ok := result["structuredContent"].(map[string]any)
+		if !ok {
+			t.Fatalf("Expected structured content, got %v", result)
+		}
+		if structured["thought"] != "shared" || structured["thoughtHistoryLength"] != float64(1) {
+			t.Errorf("Expected the recorded thought, got %v", structured)
+		}
+		if result["_meta"] == nil || result["content"] == nil {
+			t.Errorf("Expected meta and content next to structured content, got %v", result)
+		}
+
+		result = call(t, `{"jsonrpc":"2.0","id":4,"method":"tools/call","params":{"name":"list_sessions","arguments":{}}}`)
+		if _, ok := result["structuredContent"]; ok || result["content"] == nil {
+			t.Errorf("Expected plain result from list_sessions, got %v", result)
+		}
+	})
+
+	t.Run("unknown tool", func(t *testing.T) {
+		result := call(t, `{"jsonrpc":"2.0","id":5,"method":"tools/call","params":{"name":"nope","arguments":{}}}`)
+		if msg, _ := result["data"].(string); !strings.Contains(msg, "tool not found") {
+			t.Errorf("Expected tool not found error, got %v", result)
+		}
+	})
+}
@@ -0,0 +1,380 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/strowk/foxy-contexts/pkg/jsonrpc2"
+	"github.com/strowk/foxy-contexts/pkg/mcp"
+	"github.com/strowk/foxy-contexts/pkg/server"
+	"github.com/strowk/foxy-contexts/pkg/stdio"
+)
+
+const (
+	// sessionHeader carries the session of the streamable HTTP transport.
+	sessionHeader = "Mcp-Session-Id"
+
+	maxMessageSize = 4 << 20
+
+	// defaultSessionIdleTimeout is how long a streamable HTTP session is
+	// kept without requests before it is evicted.
+	defaultSessionIdleTimeout = 30 * time.Minute
+
+	// connReadHeaderTimeout and connIdleTimeout keep slow or idle clients from
+	// holding connections. There is no read or write timeout, since event
+	// streams stay open for as long as the client listens.
+	connReadHeaderTimeout = 10 * time.Second
+	connIdleTimeout       = 2 * time.Minute
+)
+
+// httpTransport serves MCP over HTTP. Every client gets its own MCP server,
+// while tools, resources and prompts (and the thought store behind them) are
+// shared by all clients.
+//
+// In SSE mode it implements the HTTP+SSE transport: clients open GET /sse,
+// receive the endpoint to POST messages to and get their responses as
+// events on the stream. Otherwise it implements the streamable HTTP
+// transport: clients POST messages to /mcp and get the response in the body.
+// Streamable HTTP sessions are started by an initialize request and end when
+// the client deletes them or after idleTimeout without requests.
+//
+// Requests from browsers are only accepted from loopback origins and
+// allowedOrigins, so web pages cannot reach a local server through DNS
+// rebinding.
+type httpTransport struct {
+	addr           string
+	sse            bool
+	allowedOrigins []string
+	// idleTimeout defaults to defaultSessionIdleTimeout if zero.
+	idleTimeout time.Duration
+
+	mu       sync.Mutex
+	srv      *http.Server
+	sessions map[string]*httpSession
+	stopping chan struct{}
+}
+
+type httpSession struct {
+	mu     sync.Mutex
+	server server.Server
+	events chan []byte
+
+	// lastUsed is guarded by the transport lock.
+	lastUsed time.Time
+}
+
+// newTransport creates the transport called name, listening on addr and
+// accepting allowedOrigins when it is served over HTTP.
+func newTransport(name, addr string, allowedOrigins []string) (server.Transport, error) {
+	switch name {
+	case "stdio":
+		return stdio.NewTransport(), nil
+	case "sse":
+		return NewSSETransport(addr, allowedOrigins...), nil
+	case "http":
+		return NewHTTPTransport(addr, allowedOrigins...), nil
+	}
+	return nil, fmt.Errorf("unknown transport %q, expected stdio, sse or http", name)
+}
+
+// NewHTTPTransport creates a streamable HTTP transport listening on addr.
+// Browsers are accepted from loopback origins and allowedOrigins, "*" for
+// any origin.
+func NewHTTPTransport(addr string, allowedOrigins ...string) server.Transport {
+	return &httpTransport{addr: addr, allowedOrigins: allowedOrigins}
+}
+
+// NewSSETransport creates an HTTP+SSE transport listening on addr.
+// Browsers are accepted from loopback origins and allowedOrigins, "*" for
+// any origin.
+func NewSSETransport(addr string, allowedOrigins ...string) server.Transport {
+	return &httpTransport{addr: addr, sse: true, allowedOrigins: allowedOrigins}
+}
+
+func (t *httpTransport) Run(
+	capabilities *mcp.ServerCapabilities,
+	serverInfo *mcp.Implementation,
+	options ...server.ServerOption,
+) error {
+	t.mu.Lock()
+	t.srv = &http.Server{
+		Addr:              t.addr,
+		Handler:           t.handler(capabilities, serverInfo, options...),
+		ReadHeaderTimeout: connReadHeaderTimeout,
+		IdleTimeout:       connIdleTimeout,
+	}
+	// Event streams never end on their own, so they have to be told.
+	t.srv.RegisterOnShutdown(func() { close(t.stopping) })
+	srv := t.srv
+	t.mu.Unlock()
+
+	if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+func (t *httpTransport) Shutdown(ctx context.Context) error {
+	t.mu.Lock()
+	srv := t.srv
+	t.mu.Unlock()
+
+	if srv == nil {
+		return nil
+	}
+	return srv.Shutdown(ctx)
+}
+
+func (t *httpTransport) handler(
+	capabilities *mcp.ServerCapabilities,
+	serverInfo *mcp.Implementation,
+	options ...server.ServerOption,
+) http.Handler {
+	t.sessions = make(map[string]*httpSession)
+	t.stopping = make(chan struct{})
+
+	newSession := func(withEvents bool) (string, *httpSession, error) {
+		id, err := newSessionID()
+		if err != nil {
+			return "", nil, err
+		}
+		sess := &httpSession{server: server.NewServer(capabilities, serverInfo, options...)}
+		if withEvents {
+			sess.events = make(chan []byte, 16)
+		}
+
+		t.mu.Lock()
+		t.evictIdle()
+		sess.lastUsed = time.Now()
+		t.sessions[id] = sess
+		t.mu.Unlock()
+		return id, sess, nil
+	}
+
+	mux := http.NewServeMux()
+	if t.sse {
+		mux.HandleFunc("GET /sse", func(w http.ResponseWriter, r *http.Request) {
+			id, sess, err := newSession(true)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			defer t.endSession(id)
+			t.serveEvents(w, r, id, sess)
+		})
+		mux.HandleFunc("POST /message", func(w http.ResponseWriter, r *http.Request) {
+			sess := t.session(r.URL.Query().Get("sessionId"))
+			if sess == nil {
+				http.Error(w, "session not found", http.StatusNotFound)
+				return
+			}
+			body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxMessageSize))
+			if err != nil {
+				http.Error(w, "failed to read request body", http.StatusBadRequest)
+				return
+			}
+			if res, ok := sess.call(body); ok {
+				select {
+				case sess.events <- res:
+				case <-r.Context().Done():
+					return
+				}
+			}
+			w.WriteHeader(http.StatusAccepted)
+		})
+		return t.checkOrigin(mux)
+	}
+
+	mux.HandleFunc("POST /mcp", func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxMessageSize))
+		if err != nil {
+			http.Error(w, "failed to read request body", http.StatusBadRequest)
+			return
+		}
+
+		id := r.Header.Get(sessionHeader)
+		sess := t.session(id)
+		switch {
+		case id == "" && !isInitialize(body):
+			http.Error(w, "missing "+sessionHeader+" header, start a session with initialize", http.StatusBadRequest)
+			return
+		case id == "":
+			if id, sess, err = newSession(false); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		case sess == nil:
+			http.Error(w, "session not found", http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set(sessionHeader, id)
+		res, ok := sess.call(body)
+		if !ok {
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(res)
+	})
+	mux.HandleFunc("DELETE /mcp", func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(sessionHeader)
+		if t.session(id) == nil {
+			http.Error(w, "session not found", http.StatusNotFound)
+			return
+		}
+		t.endSession(id)
+		w.WriteHeader(http.StatusNoContent)
+	})
+	return t.checkOrigin(mux)
+}
+
+// checkOrigin rejects requests whose Origin header is not allowed. Requests
+// without one do not come from a browser and are always accepted.
+func (t *httpTransport) checkOrigin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if origin := r.Header.Get("Origin"); origin != "" && !t.originAllowed(origin) {
+			http.Error(w, "origin not allowed", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (t *httpTransport) originAllowed(origin string) bool {
+	if slices.Contains(t.allowedOrigins, "*") || slices.Contains(t.allowedOrigins, origin) {
+		return true
+	}
+
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	if host := u.Hostname(); host == "localhost" {
+		return true
+	} else if ip := net.ParseIP(host); ip != nil && ip.IsLoopback() {
+		return true
+	}
+	return false
+}
+
+func (t *httpTransport) serveEvents(w http.ResponseWriter, r *http.Request, id string, sess *httpSession) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	fmt.Fprintf(w, "event: endpoint\ndata: /message?sessionId=%s\n\n", id)
+	flusher.Flush()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-t.stopping:
+			return
+		case data := <-sess.events:
+			fmt.Fprintf(w, "event: message\ndata: %s\n\n", data)
+			flusher.Flush()
+		}
+	}
+}
+
+func (t *httpTransport) session(id string) *httpSession {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	sess := t.sessions[id]
+	if sess != nil {
+		sess.lastUsed = time.Now()
+	}
+	return sess
+}
+
+// evictIdle ends the streamable HTTP sessions that have not been used for
+// idleTimeout, since clients that go away without deleting their session
+// would otherwise keep it forever. SSE sessions end with their stream. The
+// caller must hold the transport lock.
+func (t *httpTransport) evictIdle() {
+	timeout := t.idleTimeout
+	if timeout == 0 {
+		timeout = defaultSessionIdleTimeout
+	}
+
+	for id, sess := range t.sessions {
+		if sess.events == nil && time.Since(sess.lastUsed) > timeout {
+			delete(t.sessions, id)
+		}
+	}
+}
+
+func (t *httpTransport) endSession(id string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	delete(t.sessions, id)
+}
+
+// call hands a message to the session's server and returns the encoded
+// response, if the message was a request. Messages of one session are
+// handled one at a time so responses cannot be mixed up.
+func (s *httpSession) call(body []byte) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.server.Handle(body)
+		close(done)
+	}()
+
+	// Handle blocks on sending the response, so done can only win the race
+	// when there is no response to wait for.
+	select {
+	case res := <-s.server.GetResponses():
+		<-done
+		data, err := jsonrpc2.Marshal(res.Id, res.Result, res.Error)
+		if err != nil {
+			data, _ = jsonrpc2.Marshal(res.Id, nil, &jsonrpc2.Error{
+				Code:    -32603, // internal error
+				Message: fmt.Sprintf("failed to encode response: %v", err),
+			})
+		}
+		return data, true
+	case <-done:
+		return nil, false
+	}
+}
+
+// isInitialize reports whether body is an initialize request, the only
+// message that may start a streamable HTTP session.
+func isInitialize(body []byte) bool {
+	var msg struct {
+		Method string `json:"method"`
+	}
+	return json.Unmarshal(body, &msg) == nil && msg.Method == "initialize"
+}
+
+func newSessionID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate session id: %v", err)
+	}
+	return hex.EncodeToString(b), nil
+}
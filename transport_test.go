@@ -0,0 +1,302 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/strowk/foxy-contexts/pkg/fxctx"
+	"github.com/strowk/foxy-contexts/pkg/mcp"
+	"github.com/strowk/foxy-contexts/pkg/server"
+)
+
+const (
+	initializeMessage = `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2024-11-05","capabilities":{},"clientInfo":{"name":"test","version":"0.0.0"}}}`
+	initializedNotice = `{"jsonrpc":"2.0","method":"notifications/initialized"}`
+	thoughtCall       = `{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"sequential_thinking","arguments":{"thought":"shared","thoughtNumber":1,"totalThoughts":2}}}`
+)
+
+func newTestTransportServer(t *testing.T, transport *httpTransport) *httptest.Server {
+	t.Helper()
+
+	tools := []fxctx.Tool{NewSequentialThinkingTool(NewThoughtStore(), Options{})}
+	handler := transport.handler(
+		&mcp.ServerCapabilities{Tools: &mcp.ServerCapabilitiesTools{}},
+		&mcp.Implementation{Name: "sequential_thinking", Version: "test"},
+		server.ServerStartCallbackOption{Callback: func(s server.Server) { registerToolHandlers(s, tools) }},
+	)
+
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func postMCP(t *testing.T, url, sessionID, body string) *http.Response {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodPost, url+"/mcp", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if sessionID != "" {
+		req.Header.Set(sessionHeader, sessionID)
+	}
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	t.Cleanup(func() { _ = res.Body.Close() })
+	return res
+}
+
+func decodeToolResult(t *testing.T, data []byte) mcp.CallToolResult {
+	t.Helper()
+
+	var msg struct {
+		Result mcp.CallToolResult `json:"result"`
+	}
+	if err := json.Unmarshal(data, &msg); err != nil {
+		t.Fatalf("Failed to decode response %s: %v", data, err)
+	}
+	return msg.Result
+}
+
+func TestHTTPTransport(t *testing.T) {
+	srv := newTestTransportServer(t, &httpTransport{})
+
+	startSession := func(t *testing.T) string {
+		t.Helper()
+
+		res := postMCP(t, srv.URL, "", initializeMessage)
+		if res.StatusCode != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d", res.StatusCode)
+		}
+		id := res.Header.Get(sessionHeader)
+		if id == "" {
+			t.Fatal("Expected a session id")
+		}
+
+		body, _ := io.ReadAll(res.Body)
+		if !strings.Contains(string(body), `"serverInfo"`) {
+			t.Errorf("Expected initialize result, got %s", body)
+		}
+
+		if res := postMCP(t, srv.URL, id, initializedNotice); res.StatusCode != http.StatusAccepted {
+			t.Errorf("Expected status 202 for notification, got %d", res.StatusCode)
+		}
+		return id
+	}
+
+	t.Run("clients share the thought store", func(t *testing.T) {
+		first, second := startSession(t), startSession(t)
+		if first == second {
+			t.Fatal("Expected different sessions per client")
+		}
+
+		for i, id := range []string{first, second} {
+			res := postMCP(t, srv.URL, id, thoughtCall)
+			if ct := res.Header.Get("Content-Type"); ct != "application/json" {
+				t.Errorf("Expected JSON response, got %s", ct)
+			}
+			body, _ := io.ReadAll(res.Body)
+			result := decodeToolResult(t, body)
+			if histLen := result.Meta["thoughtHistoryLength"]; histLen != float64(i+1) {
+				t.Errorf("Expected thoughtHistoryLength = %d, got %v", i+1, histLen)
+			}
+		}
+	})
+
+	t.Run("only initialize starts a session", func(t *testing.T) {
+		res := postMCP(t, srv.URL, "", thoughtCall)
+		if res.StatusCode != http.StatusBadRequest {
+			t.Errorf("Expected status 400, got %d", res.StatusCode)
+		}
+		if id := res.Header.Get(sessionHeader); id != "" {
+			t.Errorf("Expected no session, got %s", id)
+		}
+	})
+
+	t.Run("unknown session", func(t *testing.T) {
+		if res := postMCP(t, srv.URL, "missing", thoughtCall); res.StatusCode != http.StatusNotFound {
+			t.Errorf("Expected status 404, got %d", res.StatusCode)
+		}
+	})
+
+	t.Run("ending a session", func(t *testing.T) {
+		id := startSession(t)
+
+		req, _ := http.NewRequest(http.MethodDelete, srv.URL+"/mcp", nil)
+		req.Header.Set(sessionHeader, id)
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		_ = res.Body.Close()
+		if res.StatusCode != http.StatusNoContent {
+			t.Errorf("Expected status 204, got %d", res.StatusCode)
+		}
+
+		if res := postMCP(t, srv.URL, id, thoughtCall); res.StatusCode != http.StatusNotFound {
+			t.Errorf("Expected status 404 after ending the session, got %d", res.StatusCode)
+		}
+	})
+}
+
+func TestHTTPTransportIdleSessions(t *testing.T) {
+	transport := &httpTransport{idleTimeout: 20 * time.Millisecond}
+	srv := newTestTransportServer(t, transport)
+
+	idle := postMCP(t, srv.URL, "", initializeMessage).Header.Get(sessionHeader)
+	time.Sleep(50 * time.Millisecond)
+
+	// Starting a session sweeps the ones left idle.
+	postMCP(t, srv.URL, "", initializeMessage)
+	if res := postMCP(t, srv.URL, idle, thoughtCall); res.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected the idle session to be evicted, got status %d", res.StatusCode)
+	}
+
+	transport.mu.Lock()
+	defer transport.mu.Unlock()
+	if n := len(transport.sessions); n != 1 {
+		t.Errorf("Expected 1 session left, got %d", n)
+	}
+}
+
+func TestHTTPTransportOrigins(t *testing.T) {
+	srv := newTestTransportServer(t, &httpTransport{allowedOrigins: []string{"https://app.example"}})
+
+	testCases := []struct {
+		origin string
+		status int
+	}{
+		{origin: "", status: http.StatusOK},
+		{origin: "http://localhost:3000", status: http.StatusOK},
+		{origin: "http://127.0.0.1:5173", status: http.StatusOK},
+		{origin: "http://[::1]", status: http.StatusOK},
+		{origin: "https://app.example", status: http.StatusOK},
+		{origin: "https://evil.example", status: http.StatusForbidden},
+		{origin: "http://localhost.evil.example", status: http.StatusForbidden},
+		{origin: "null", status: http.StatusForbidden},
+	}
+
+	for _, tc := range testCases {
+		req, err := http.NewRequest(http.MethodPost, srv.URL+"/mcp", strings.NewReader(initializeMessage))
+		if err != nil {
+			t.Fatalf("Failed to create request: %v", err)
+		}
+		if tc.origin != "" {
+			req.Header.Set("Origin", tc.origin)
+		}
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		_ = res.Body.Close()
+		if res.StatusCode != tc.status {
+			t.Errorf("Origin %q: expected status %d, got %d", tc.origin, tc.status, res.StatusCode)
+		}
+	}
+
+	t.Run("any origin", func(t *testing.T) {
+		srv := newTestTransportServer(t, &httpTransport{allowedOrigins: []string{"*"}})
+		req, _ := http.NewRequest(http.MethodPost, srv.URL+"/mcp", strings.NewReader(initializeMessage))
+		req.Header.Set("Origin", "https://evil.example")
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		_ = res.Body.Close()
+		if res.StatusCode != http.StatusOK {
+			t.Errorf("Expected status 200, got %d", res.StatusCode)
+		}
+	})
+}
+
+func TestSSETransport(t *testing.T) {
+	srv := newTestTransportServer(t, &httpTransport{sse: true})
+
+	res, err := http.Get(srv.URL + "/sse")
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer func() { _ = res.Body.Close() }()
+
+	if ct := res.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Expected event stream, got %s", ct)
+	}
+
+	events := bufio.NewReader(res.Body)
+	readEvent := func() (string, string) {
+		t.Helper()
+
+		var event, data string
+		for {
+			line, err := events.ReadString('\n')
+			if err != nil {
+				t.Fatalf("Failed to read event: %v", err)
+			}
+			line = strings.TrimRight(line, "\n")
+			switch {
+			case line == "":
+				return event, data
+			case strings.HasPrefix(line, "event: "):
+				event = strings.TrimPrefix(line, "event: ")
+			case strings.HasPrefix(line, "data: "):
+				data = strings.TrimPrefix(line, "data: ")
+			}
+		}
+	}
+
+	event, endpoint := readEvent()
+	if event != "endpoint" || !strings.HasPrefix(endpoint, "/message?sessionId=") {
+		t.Fatalf("Expected endpoint event, got %s %s", event, endpoint)
+	}
+
+	post := func(body string) {
+		t.Helper()
+
+		res, err := http.Post(srv.URL+endpoint, "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		_ = res.Body.Close()
+		if res.StatusCode != http.StatusAccepted {
+			t.Fatalf("Expected status 202, got %d", res.StatusCode)
+		}
+	}
+
+	post(initializeMessage)
+	if event, data := readEvent(); event != "message" || !strings.Contains(data, `"serverInfo"`) {
+		t.Fatalf("Expected initialize response, got %s %s", event, data)
+	}
+
+	post(initializedNotice)
+	post(thoughtCall)
+	event, data := readEvent()
+	if event != "message" {
+		t.Fatalf("Expected message event, got %s", event)
+	}
+	result := decodeToolResult(t, []byte(data))
+	if result.IsError != nil && *result.IsError {
+		t.Errorf("Expected successful tool call, got %v", result.Content)
+	}
+}
+
+func TestNewTransport(t *testing.T) {
+	for _, name := range []string{"stdio", "sse", "http"} {
+		if _, err := newTransport(name, "127.0.0.1:0", nil); err != nil {
+			t.Errorf("Expected transport %s, got %v", name, err)
+		}
+	}
+
+	if _, err := newTransport("carrier-pigeon", "", nil); err == nil {
+		t.Error("Expected error for unknown transport")
+	}
+}